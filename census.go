@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"uk.ac.bris.cs/gameoflife/census"
+)
+
+// censusPeriod is the most turns each object of the final world is run for to find its period. Objects that take
+// longer to repeat, which are usually parts of the soup that haven't settled yet, are counted as PATHOLOGICAL,
+// and objects that die out within that many turns as DIES.
+const censusPeriod = 256
+
+// writeCensusFile counts the objects in world, writes the census to path as CSV and prints it to messages.
+func writeCensusFile(path string, world [][]byte, messages io.Writer) error {
+	c := census.Take(world, censusPeriod)
+	file, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	err = c.WriteCSV(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(messages, "File", path, "census done!")
+	_ = c.WriteText(messages)
+	return nil
+}
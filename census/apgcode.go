@@ -0,0 +1,223 @@
+package census
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pathological is the apgcode of an object that doesn't repeat within the turns it is run for,
+// such as a soup that hasn't settled yet.
+const Pathological = "PATHOLOGICAL"
+
+// Dies is the apgcode given to an object that dies out within the turns it is run for, such as a lone cell or
+// the debris of a collision. It is counted apart from Pathological so that dying debris isn't taken for unsettled soup.
+const Dies = "DIES"
+
+// Object is an island of cells identified by running it on its own on an infinite board.
+type Object struct {
+	Code         string // apgcode, Pathological or Dies
+	Period       int    // Turns between repeats, 1 for a still life, 0 for Pathological and Dies
+	Displacement Point  // How far the object moves every period, which is nothing unless it is a spaceship
+}
+
+// Classify runs the cells on their own for up to maxPeriod turns to find how often they repeat and how far they
+// move, and names them with the apgcode of their smallest phase:
+//   - xs followed by the population for still lifes, e.g. xs4_33 for a block
+//   - xp followed by the period for oscillators, e.g. xp2_7 for a blinker
+//   - xq followed by the period for spaceships, e.g. xq4_153 for a glider
+//
+// Cells that die out within maxPeriod turns are Dies, and cells that neither die out nor repeat are Pathological.
+func Classify(cells []Point, maxPeriod int) Object {
+	start := normalise(cells)
+	phases := [][]Point{start}
+	current := cells
+	for turn := 1; turn <= maxPeriod; turn++ {
+		current = step(current)
+		next := normalise(current)
+		if len(next) == 0 {
+			return Object{Code: Dies}
+		}
+		if equal(next, start) {
+			o := Object{Period: turn, Displacement: corner(current).minus(corner(cells))}
+			switch {
+			case o.Displacement != Point{}:
+				o.Code = "xq" + strconv.Itoa(turn) + "_" + canonical(phases)
+			case turn == 1:
+				o.Code = "xs" + strconv.Itoa(len(cells)) + "_" + canonical(phases)
+			default:
+				o.Code = "xp" + strconv.Itoa(turn) + "_" + canonical(phases)
+			}
+			return o
+		}
+		phases = append(phases, next)
+	}
+	return Object{Code: Pathological}
+}
+
+func (p Point) minus(q Point) Point {
+	return Point{p.X - q.X, p.Y - q.Y}
+}
+
+// step plays a single turn on an infinite board.
+func step(cells []Point) []Point {
+	alive := make(map[Point]bool, len(cells))
+	neighbours := make(map[Point]int, 9*len(cells))
+	for _, c := range cells {
+		alive[c] = true
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx != 0 || dy != 0 {
+					neighbours[Point{c.X + dx, c.Y + dy}]++
+				}
+			}
+		}
+	}
+	var next []Point
+	for c, n := range neighbours {
+		if n == 3 || n == 2 && alive[c] {
+			next = append(next, c)
+		}
+	}
+	return next
+}
+
+// corner returns the top left corner of the smallest rectangle holding the cells.
+func corner(cells []Point) Point {
+	if len(cells) == 0 {
+		return Point{}
+	}
+	min := cells[0]
+	for _, c := range cells[1:] {
+		if c.X < min.X {
+			min.X = c.X
+		}
+		if c.Y < min.Y {
+			min.Y = c.Y
+		}
+	}
+	return min
+}
+
+// normalise returns the cells moved so that their top left corner is (0, 0), in row order.
+func normalise(cells []Point) []Point {
+	min := corner(cells)
+	moved := make([]Point, len(cells))
+	for i, c := range cells {
+		moved[i] = c.minus(min)
+	}
+	sort.Slice(moved, func(i, j int) bool {
+		if moved[i].Y != moved[j].Y {
+			return moved[i].Y < moved[j].Y
+		}
+		return moved[i].X < moved[j].X
+	})
+	return moved
+}
+
+func equal(a, b []Point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// orientations are the eight rotations and reflections of a cell.
+var orientations = []func(Point) Point{
+	func(p Point) Point { return Point{p.X, p.Y} },
+	func(p Point) Point { return Point{-p.X, p.Y} },
+	func(p Point) Point { return Point{p.X, -p.Y} },
+	func(p Point) Point { return Point{-p.X, -p.Y} },
+	func(p Point) Point { return Point{p.Y, p.X} },
+	func(p Point) Point { return Point{-p.Y, p.X} },
+	func(p Point) Point { return Point{p.Y, -p.X} },
+	func(p Point) Point { return Point{-p.Y, -p.X} },
+}
+
+// canonical returns the extended Wechsler format of whichever phase and orientation gives the shortest,
+// then alphabetically first, representation, so that every copy of an object has the same name.
+func canonical(phases [][]Point) string {
+	best := ""
+	for _, phase := range phases {
+		for _, orient := range orientations {
+			turned := make([]Point, len(phase))
+			for i, c := range phase {
+				turned[i] = orient(c)
+			}
+			w := wechsler(normalise(turned))
+			if best == "" || len(w) < len(best) || len(w) == len(best) && w < best {
+				best = w
+			}
+		}
+	}
+	return best
+}
+
+// wechslerDigits are the characters for the 32 columns of a strip.
+const wechslerDigits = "0123456789abcdefghijklmnopqrstuv"
+
+// wechsler returns the extended Wechsler format of normalised cells. The rows are split into strips five cells
+// high, separated by z. Each column of a strip is a character whose bits are its cells, with the top cell least
+// significant. Runs of blank columns are shortened to w for two, x for three and y followed by a character for
+// four to thirty-nine, and are left out at the end of a strip.
+func wechsler(cells []Point) string {
+	var width, height int
+	for _, c := range cells {
+		if c.X >= width {
+			width = c.X + 1
+		}
+		if c.Y >= height {
+			height = c.Y + 1
+		}
+	}
+	strips := make([][]uint, (height+4)/5)
+	for i := range strips {
+		strips[i] = make([]uint, width)
+	}
+	for _, c := range cells {
+		strips[c.Y/5][c.X] |= 1 << uint(c.Y%5)
+	}
+
+	var b strings.Builder
+	for i, strip := range strips {
+		if i > 0 {
+			b.WriteByte('z')
+		}
+		blanks := 0
+		for _, column := range strip {
+			if column == 0 {
+				blanks++
+				continue
+			}
+			writeBlanks(&b, blanks)
+			blanks = 0
+			b.WriteByte(wechslerDigits[column])
+		}
+	}
+	return b.String()
+}
+
+// writeBlanks writes a run of blank columns.
+func writeBlanks(b *strings.Builder, blanks int) {
+	for ; blanks >= 4; blanks -= 39 {
+		if blanks < 39 {
+			b.WriteByte('y')
+			b.WriteByte("0123456789abcdefghijklmnopqrstuvwxyz"[blanks-4])
+			return
+		}
+		b.WriteString("yz")
+	}
+	switch blanks {
+	case 1:
+		b.WriteByte('0')
+	case 2:
+		b.WriteByte('w')
+	case 3:
+		b.WriteByte('x')
+	}
+}
@@ -0,0 +1,106 @@
+package census
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pattern returns the cells marked O in rows of a picture.
+func pattern(rows ...string) []Point {
+	var cells []Point
+	for y, row := range rows {
+		for x, c := range row {
+			if c == 'O' {
+				cells = append(cells, Point{x, y})
+			}
+		}
+	}
+	return cells
+}
+
+// pulsar returns the cells of a pulsar with its top left corner at (0, 0).
+func pulsar() []Point {
+	var cells []Point
+	for _, line := range []int{0, 5, 7, 12} {
+		for _, along := range []int{2, 3, 4, 8, 9, 10} {
+			cells = append(cells, Point{along, line}, Point{line, along})
+		}
+	}
+	return cells
+}
+
+// moved returns the cells moved by (dx, dy).
+func moved(cells []Point, dx, dy int) []Point {
+	var out []Point
+	for _, c := range cells {
+		out = append(out, Point{c.X + dx, c.Y + dy})
+	}
+	return out
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		cells  []Point
+		object Object
+	}{
+		{"block", pattern("OO", "OO"), Object{"xs4_33", 1, Point{}}},
+		{"beehive", pattern(".OO.", "O..O", ".OO."), Object{"xs6_696", 1, Point{}}},
+		{"boat", pattern("OO.", "O.O", ".O."), Object{"xs5_253", 1, Point{}}},
+		{"blinker", pattern("OOO"), Object{"xp2_7", 2, Point{}}},
+		{"toad", pattern(".OOO", "OOO."), Object{"xp2_7e", 2, Point{}}},
+		{"beacon", pattern("OO..", "OO..", "..OO", "..OO"), Object{"xp2_318c", 2, Point{}}},
+		{"pulsar", pulsar(), Object{"xp3_co9nas0san9oczgoldlo0oldlogz1047210127401", 3, Point{}}},
+		{"glider", pattern(".O.", "..O", "OOO"), Object{"xq4_153", 4, Point{1, 1}}},
+		{"lwss", pattern("O..O.", "....O", "O...O", ".OOOO"), Object{"xq4_6frc", 4, Point{2, 0}}},
+		{"r-pentomino", pattern(".OO", "OO.", ".O."), Object{Pathological, 0, Point{}}},
+		{"lone cell", pattern("O"), Object{Dies, 0, Point{}}},
+		{"domino", pattern("OO"), Object{Dies, 0, Point{}}},
+		{"dies later", pattern("O..", ".O.", "..O"), Object{Dies, 0, Point{}}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.object, Classify(test.cells, 100), test.name)
+	}
+}
+
+func TestClassifyIsCanonical(t *testing.T) {
+	glider := pattern(".O.", "..O", "OOO")
+	for i, orient := range orientations {
+		var turned []Point
+		for _, c := range glider {
+			turned = append(turned, orient(c))
+		}
+		// Every orientation and phase of a glider, anywhere, has the same name
+		for phase := 0; phase < 4; phase++ {
+			assert.Equal(t, "xq4_153", Classify(moved(turned, 7, -3), 4).Code, "orientation %d, phase %d", i, phase)
+			turned = step(turned)
+		}
+	}
+
+	assert.Equal(t, Pathological, Classify(pattern(".O.", "..O", "OOO"), 3).Code, "a glider takes 4 turns to repeat")
+}
+
+func TestWechsler(t *testing.T) {
+	tests := map[string][]Point{
+		"33":      pattern("OO", "OO"),
+		"7":       pattern("O", "O", "O"),
+		"1z1":     pattern("O", ".", ".", ".", ".", "O"),
+		"1zz1":    pattern("O", ".", ".", ".", ".", ".", ".", ".", ".", ".", "O"),
+		"101":     pattern("O.O"),
+		"1w1":     pattern("O..O"),
+		"1x1":     pattern("O...O"),
+		"1y01":    pattern("O....O"),
+		"1yz1":    pattern("O" + strings.Repeat(".", 39) + "O"),
+		"1yz01":   pattern("O" + strings.Repeat(".", 40) + "O"),
+		"1yzy01":  pattern("O" + strings.Repeat(".", 43) + "O"),
+		"1z01":    pattern("O.", "..", "..", "..", "..", ".O"),
+		"v":       pattern("O", "O", "O", "O", "O"),
+		"vzv":     pattern("O", "O", "O", "O", "O", "O", "O", "O", "O", "O"),
+		"1yc1z01": pattern("O"+strings.Repeat(".", 16)+"O", "", "", "", "", ".O"),
+	}
+	for want, cells := range tests {
+		assert.Equal(t, want, wechsler(normalise(cells)))
+	}
+}
@@ -0,0 +1,151 @@
+// Package census finds the objects a Game of Life world has settled into and names them with apgcodes,
+// the names apgsearch gives objects, such as xs4_33 for a block or xq4_153 for a glider.
+package census
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Point is a cell. Points of an island may lie outside the board, where the island wraps around its edges.
+type Point struct {
+	X, Y int
+}
+
+// Islands splits the alive cells of a world on a torus into groups close enough to affect each other, which are
+// cells within two cells of each other in both directions. Each island has coordinates that are consecutive across
+// the edges of the board, so that an island wrapping around an edge can be run on its own.
+func Islands(world [][]byte) [][]Point {
+	height := len(world)
+	if height == 0 {
+		return nil
+	}
+	width := len(world[0])
+	seen := make([][]bool, height)
+	for y := range seen {
+		seen[y] = make([]bool, width)
+	}
+
+	var islands [][]Point
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if world[y][x] == 0 || seen[y][x] {
+				continue
+			}
+			seen[y][x] = true
+			island := []Point{{x, y}}
+			for i := 0; i < len(island); i++ {
+				p := island[i]
+				for dy := -2; dy <= 2; dy++ {
+					for dx := -2; dx <= 2; dx++ {
+						q := Point{p.X + dx, p.Y + dy}
+						wx, wy := mod(q.X, width), mod(q.Y, height)
+						if world[wy][wx] != 0 && !seen[wy][wx] {
+							seen[wy][wx] = true
+							island = append(island, q)
+						}
+					}
+				}
+			}
+			islands = append(islands, island)
+		}
+	}
+	return islands
+}
+
+// wraps reports whether an island is close enough to itself across the edges of a width by height board for its
+// cells to affect each other, so that it can't be run on its own.
+func wraps(island []Point, width, height int) bool {
+	min, max := island[0], island[0]
+	for _, p := range island[1:] {
+		if p.X < min.X {
+			min.X = p.X
+		}
+		if p.X > max.X {
+			max.X = p.X
+		}
+		if p.Y < min.Y {
+			min.Y = p.Y
+		}
+		if p.Y > max.Y {
+			max.Y = p.Y
+		}
+	}
+	return max.X-min.X >= width-2 || max.Y-min.Y >= height-2
+}
+
+// mod returns a modulo m, which unlike % is never negative.
+func mod(a, m int) int {
+	return (a%m + m) % m
+}
+
+// Entry is the number of objects with the same apgcode.
+type Entry struct {
+	Code  string
+	Count int
+}
+
+// Census is the number of each kind of object in a world, most common first.
+type Census []Entry
+
+// Take finds every island of the world and counts the objects by apgcode. Islands that don't repeat within
+// maxPeriod turns, or that reach far enough around the board to affect themselves, are counted as Pathological,
+// and islands that die out within maxPeriod turns are counted as Dies.
+func Take(world [][]byte, maxPeriod int) Census {
+	counts := make(map[string]int)
+	for _, island := range Islands(world) {
+		if wraps(island, len(world[0]), len(world)) {
+			counts[Pathological]++
+		} else {
+			counts[Classify(island, maxPeriod).Code]++
+		}
+	}
+
+	c := make(Census, 0, len(counts))
+	for code, count := range counts {
+		c = append(c, Entry{code, count})
+	}
+	sort.Slice(c, func(i, j int) bool {
+		if c[i].Count != c[j].Count {
+			return c[i].Count > c[j].Count
+		}
+		return c[i].Code < c[j].Code
+	})
+	return c
+}
+
+// Objects returns the total number of objects counted.
+func (c Census) Objects() int {
+	total := 0
+	for _, e := range c {
+		total += e.Count
+	}
+	return total
+}
+
+// WriteText writes the census as a table.
+// noinspection GoUnhandledErrorResult
+func (c Census) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "Census of %d objects:\n", c.Objects())
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "Count\tObject")
+	for _, e := range c {
+		fmt.Fprintf(w, "%d\t%s\n", e.Count, e.Code)
+	}
+	return w.Flush()
+}
+
+// WriteCSV writes the census with a header row of apgcode,count.
+func (c Census) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"apgcode", "count"})
+	for _, e := range c {
+		_ = w.Write([]string{e.Code, strconv.Itoa(e.Count)})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,87 @@
+package census
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// board returns a width by height world with the given cells alive, wrapping them around the edges.
+func board(width, height int, cells ...Point) [][]byte {
+	world := make([][]byte, height)
+	for y := range world {
+		world[y] = make([]byte, width)
+	}
+	for _, c := range cells {
+		world[mod(c.Y, height)][mod(c.X, width)] = 0xFF
+	}
+	return world
+}
+
+func TestIslands(t *testing.T) {
+	assert.Empty(t, Islands(nil))
+	assert.Empty(t, Islands(board(4, 4)))
+
+	// A block across the corner of the board, and a blinker one empty column away from a block, which affect each
+	// other and so are a single island
+	world := board(16, 16, append(moved(pattern("OO", "OO"), -1, -1),
+		append(moved(pattern("OOO"), 5, 5), moved(pattern("OO", "OO"), 9, 5)...)...)...)
+	islands := Islands(world)
+	require.Len(t, islands, 2)
+	assert.ElementsMatch(t, []Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}}, normalise(islands[0]))
+	assert.Len(t, islands[1], 7)
+
+	// Three empty columns apart they are separate
+	world = board(16, 16, append(moved(pattern("OOO"), 5, 5), moved(pattern("OO", "OO"), 11, 5)...)...)
+	assert.Len(t, Islands(world), 2)
+}
+
+func TestTake(t *testing.T) {
+	var cells []Point
+	cells = append(cells, moved(pattern("OO", "OO"), -1, 30)...) // Across the left edge
+	cells = append(cells, moved(pattern("OO", "OO"), 10, 10)...)
+	cells = append(cells, moved(pattern("O", "O", "O"), 20, 2)...) // A blinker in its other phase
+	cells = append(cells, moved(pattern("OOO"), 20, 20)...)
+	cells = append(cells, moved(pattern("OOO"), 26, 20)...)
+	cells = append(cells, moved(pattern("O.O", "OO.", ".O."), 2, 20)...)     // A glider, reflected
+	cells = append(cells, moved(pattern(".OO", "OO.", ".O."), 10, 25)...)    // Still evolving
+	cells = append(cells, moved(pattern(".OO.", "O..O", ".OO."), 30, -1)...) // Across the top edge
+	cells = append(cells, moved(pattern("OO"), 30, 30)...)                   // Dies out
+	world := board(40, 40, cells...)
+
+	c := Take(world, 100)
+	assert.Equal(t, Census{
+		{"xp2_7", 3},
+		{"xs4_33", 2},
+		{Dies, 1},
+		{Pathological, 1},
+		{"xq4_153", 1},
+		{"xs6_696", 1},
+	}, c)
+	assert.Equal(t, 9, c.Objects())
+
+	// An island reaching all the way around the board can't be run on its own
+	line := make([]Point, 10)
+	for x := range line {
+		line[x] = Point{x, 3}
+	}
+	assert.Equal(t, Census{{Pathological, 1}}, Take(board(10, 10, line...), 100))
+}
+
+func TestCensusOutput(t *testing.T) {
+	c := Census{{"xs4_33", 12}, {"xp2_7", 3}, {Pathological, 1}}
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WriteText(&buf))
+	assert.Equal(t, "Census of 16 objects:\n"+
+		"Count   Object\n"+
+		"12      xs4_33\n"+
+		"3       xp2_7\n"+
+		"1       PATHOLOGICAL\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, c.WriteCSV(&buf))
+	assert.Equal(t, "apgcode,count\nxs4_33,12\nxp2_7,3\nPATHOLOGICAL,1\n", buf.String())
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCensusOut(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	// A block, a blinker and a glider that doesn't reach either of them
+	alive := []cell{{1, 1}, {2, 1}, {1, 2}, {2, 2}, {20, 2}, {21, 2}, {22, 2}, {6, 20}, {7, 21}, {5, 22}, {6, 22}, {7, 22}}
+	c := soupCase{width: 32, height: 32, threads: 4, turns: 9, alive: alive}
+	p, err := c.writeInput(dir)
+	require.NoError(t, err)
+	p.censusOut = filepath.Join(dir, "{turns}-census.csv")
+	_, err = gameOfLife(p, nil)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "9-census.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "apgcode,count\nxp2_7,1\nxq4_153,1\nxs4_33,1\n", string(data))
+
+	p.censusOut = filepath.Join(dir, "{nope}.csv")
+	assert.Error(t, validateParams(p))
+	p.censusOut = blockedOutput(t, dir)
+	_, err = gameOfLife(p, nil)
+	assert.Error(t, err)
+}
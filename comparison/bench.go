@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bench is a single measurement from a benchmark run.
+type bench struct {
+	name  string
+	unit  string
+	value float64
+}
+
+// procsSuffix is the -GOMAXPROCS suffix go test adds to benchmark names, which is dropped so that runs
+// on machines with different numbers of cores can be compared.
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// benchName turns a name like Benchmark/512x512x8-4 into 512x512x8.
+func benchName(name string) string {
+	name = strings.TrimPrefix(name, "Benchmark")
+	name = strings.TrimPrefix(name, "/")
+	return procsSuffix.ReplaceAllString(name, "")
+}
+
+// readBenchmarks returns every measurement in the output of go test -bench, which may hold several runs.
+// A result line is the name, the number of iterations and then pairs of values and units, such as
+//
+//	Benchmark/512x512x8-4   	      10	 123456789 ns/op	  2048 B/op
+//
+// Every other line is ignored.
+func readBenchmarks(r io.Reader) ([]bench, error) {
+	var benchmarks []bench
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("line %d: a value or unit is missing", line)
+		}
+		name := benchName(fields[0])
+		for i := 2; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			benchmarks = append(benchmarks, bench{name: name, unit: fields[i+1], value: value})
+		}
+	}
+	return benchmarks, scanner.Err()
+}
+
+// cpuUnit is the unit of the CPU usage read by readCPUTimes.
+const cpuUnit = "%CPU"
+
+// readCPUTimes reads CPU usage as written by compare.sh with /usr/bin/time, one line per run such as
+//
+//	512x512x8 386%
+//
+// which is the CPU-seconds the run spent in user and kernel mode as a percentage of the time it took.
+func readCPUTimes(r io.Reader) ([]bench, error) {
+	var times []bench
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || !strings.HasSuffix(fields[1], "%") {
+			return nil, fmt.Errorf("line %d: expected a benchmark name and a percentage, got %q", line, scanner.Text())
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		times = append(times, bench{name: benchName(fields[0]), unit: cpuUnit, value: value})
+	}
+	return times, scanner.Err()
+}
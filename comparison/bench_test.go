@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchName(t *testing.T) {
+	assert.Equal(t, "512x512x8", benchName("Benchmark/512x512x8-4"))
+	assert.Equal(t, "512x512x8", benchName("Benchmark/512x512x8"))
+	assert.Equal(t, "Parse", benchName("BenchmarkParse-16"))
+	assert.Equal(t, "512x512x8", benchName("512x512x8"))
+}
+
+func TestReadBenchmarks(t *testing.T) {
+	file, err := os.Open("testdata/new.txt")
+	require.NoError(t, err)
+	defer file.Close()
+	benchmarks, err := readBenchmarks(file)
+	require.NoError(t, err)
+	require.Len(t, benchmarks, 12)
+	assert.Equal(t, bench{name: "128x128x8", unit: "ns/op", value: 62000000}, benchmarks[0])
+	assert.Equal(t, bench{name: "256x256x4", unit: "ns/op", value: 305000000}, benchmarks[11])
+
+	benchmarks, err = readBenchmarks(strings.NewReader(
+		"BenchmarkParse-8   \t 2000\t 512.5 ns/op\t  64 B/op\t   2 allocs/op\n" +
+			"Benchmark/16x16x2 is printed alone when the benchmark writes output\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []bench{
+		{name: "Parse", unit: "ns/op", value: 512.5},
+		{name: "Parse", unit: "B/op", value: 64},
+		{name: "Parse", unit: "allocs/op", value: 2},
+	}, benchmarks)
+
+	_, err = readBenchmarks(strings.NewReader("Benchmark/16x16x2-8 10 123 ns/op 64\n"))
+	assert.Error(t, err)
+	_, err = readBenchmarks(strings.NewReader("Benchmark/16x16x2-8 10 fast ns/op\n"))
+	assert.Error(t, err)
+}
+
+func TestReadCPUTimes(t *testing.T) {
+	times, err := readCPUTimes(strings.NewReader("128x128x2 190%\n\n128x128x4 385.5%\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []bench{
+		{name: "128x128x2", unit: cpuUnit, value: 190},
+		{name: "128x128x4", unit: cpuUnit, value: 385.5},
+	}, times)
+
+	for _, bad := range []string{"190%\n", "128x128x2 190\n", "128x128x2 lots%\n"} {
+		_, err := readCPUTimes(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
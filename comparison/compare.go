@@ -1,114 +1,114 @@
+// Command compare compares the output of go test -bench between a baseline and a new solution.
+//
+// Usage:
+//
+//	compare [flags] base-out.txt your-out.txt
+//	compare gate [flags]
+//
+// Each file may hold several runs of each benchmark, such as from -count, and benchmarks are matched by name.
+// CPU usage written by compare.sh can be compared too with -cpu.
+//
+// The gate subcommand runs the benchmarks and exits with an error if any got slower than the stored baseline
+// by more than their tolerance. Run it with -record to store a new baseline.
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
-	"text/tabwriter"
 )
 
-type bench struct {
-	name   string
-	result int64
-}
-
-type time struct {
-	result int
-}
+// reader is how a file of measurements is read.
+type reader func(r io.Reader) ([]bench, error)
 
-func check(e error) {
-	if e != nil {
-		panic(e)
+// readFile reads the measurements in the file at path.
+func readFile(path string, read reader) ([]bench, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-}
-
-func readCpuTimes(file []byte) []time {
-	numberRegex, _ := regexp.Compile(`\d+`)
-	rows := numberRegex.FindAllString(string(file), -1)
-	times := make([]time, len(rows))
-	for i, row := range rows {
-		result, err := strconv.Atoi(row)
-		check(err)
-		times[i] = time{result:result}
+	defer file.Close()
+	benchmarks, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
-	return times
+	return benchmarks, nil
 }
 
-//noinspection GoUnhandledErrorResult
-func analyseCpuTimes() {
-	baseBenchmarksFile, err := ioutil.ReadFile(os.Args[3])
-	check(err)
-	baseBenchmarks := readBenchmarks(baseBenchmarksFile)
-
-	baseCpuTimesFile, err := ioutil.ReadFile(os.Args[1])
-	check(err)
-	newCpuTimesFile, err := ioutil.ReadFile(os.Args[2])
-	check(err)
-	baseTimes := readCpuTimes(baseCpuTimesFile)
-	newTimes := readCpuTimes(newCpuTimesFile)
-
-	if len(baseTimes) != len(newTimes) {
-		panic("CPU time lengths don't match")
+// readPair reads the baseline and new measurements.
+func readPair(basePath, newPath string, read reader) (base, new []bench, err error) {
+	if base, err = readFile(basePath, read); err != nil {
+		return nil, nil, err
 	}
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	defer w.Flush()
-	fmt.Fprintln(w, "Benchmark\tBaseline CPU usage\tYour CPU usage\t% Difference")
-	fmt.Fprintln(w, "\t\t\tThe smaller the better")
-	for i, b := range baseBenchmarks {
-		fmt.Fprintln(w, b.name, "\t", baseTimes[i].result, "%\t", newTimes[i].result, "%\t", baseTimes[i].result*100/newTimes[i].result, "%")
+	if new, err = readFile(newPath, read); err != nil {
+		return nil, nil, err
 	}
-	fmt.Fprintln(w, "This is the percentage of the CPU that this job got. It's computed as (U + S) / E")
-	fmt.Fprintln(w, "Where")
-	fmt.Fprintln(w, "U\tTotal number of CPU-seconds that the process spent in user mode.")
-	fmt.Fprintln(w, "S\tTotal number of CPU-seconds that the process spent in kernel mode.")
-	fmt.Fprintln(w, "E\tElapsed real time")
+	return base, new, nil
 }
 
-func readBenchmarks(file []byte) []bench {
-	numberRegex, _ := regexp.Compile(`\d+`)
-	rowRegex, _ := regexp.Compile(`\d+x\d+x\d+-?\d*\s+\d+\s+\d+ ns/op`)
-	rows := rowRegex.FindAllString(string(file), -1)
-	benchmarks := make([]bench, len(rows))
-	for i, row := range rows {
-		fields := strings.Fields(row)
-		result, err := strconv.ParseInt(numberRegex.FindString(fields[2]), 10, 64)
-		check(err)
-		benchmarks[i] = bench{name: fields[0], result: result}
+// writeReport writes comparisons in the given format.
+func writeReport(w io.Writer, format string, comparisons []comparison, alpha float64) error {
+	switch format {
+	case "text":
+		return writeText(w, comparisons, alpha)
+	case "markdown":
+		return writeMarkdown(w, comparisons, alpha)
+	case "json":
+		return writeJSON(w, comparisons)
 	}
-	return benchmarks
+	return fmt.Errorf("unknown format %q, expected text, markdown or json", format)
 }
 
-//noinspection GoUnhandledErrorResult
-func analyseBenchmarks() {
-	baseBenchmarksFile, err := ioutil.ReadFile(os.Args[3])
-	check(err)
-	newBenchmarksFile, err := ioutil.ReadFile(os.Args[4])
-	check(err)
-	baseBenchmarks := readBenchmarks(baseBenchmarksFile)
-	newBenchmarks := readBenchmarks(newBenchmarksFile)
-	if len(baseBenchmarks) != len(newBenchmarks) {
-		panic("Benchmark lengths don't match")
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	format := flags.String("format", "text", "Output format: text, markdown or json.")
+	alpha := flags.Float64("alpha", 0.05, "Largest p-value at which a change counts as significant.")
+	cpu := flags.String("cpu", "", "Baseline and new CPU usage files written by compare.sh, separated by a comma.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expected a baseline and a new benchmark output file")
+	}
+	if *alpha <= 0 || *alpha >= 1 {
+		return fmt.Errorf("alpha must be between 0 and 1, got %g", *alpha)
 	}
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	defer w.Flush()
-	fmt.Fprintln(w, "Benchmark\tBaseline result\tYour result\t% Difference")
-	fmt.Fprintln(w, "\t(ns/1000 turns)\t(ns/1000 turns)\tThe bigger the better")
-	for i, b := range baseBenchmarks {
-		baselineResult := b.result
-		newResult := newBenchmarks[i].result
-		fmt.Fprintln(w, b.name, "\t", baselineResult, "\t", newResult, "\t", baselineResult*100/newResult, "%")
 
+	base, new, err := readPair(flags.Arg(0), flags.Arg(1), readBenchmarks)
+	if err != nil {
+		return err
+	}
+	if *cpu != "" {
+		paths := strings.Split(*cpu, ",")
+		if len(paths) != 2 {
+			return fmt.Errorf("-cpu needs two files separated by a comma, got %q", *cpu)
+		}
+		baseCPU, newCPU, err := readPair(paths[0], paths[1], readCPUTimes)
+		if err != nil {
+			return err
+		}
+		base, new = append(base, baseCPU...), append(new, newCPU...)
 	}
+	if len(base) == 0 && len(new) == 0 {
+		return errors.New("no benchmark results found")
+	}
+	return writeReport(stdout, *format, compareBenchmarks(base, new, *alpha), *alpha)
 }
 
 func main() {
-	fmt.Println()
-	fmt.Println("TIME RESULTS")
-	analyseBenchmarks()
-	fmt.Println()
-	fmt.Println("CPU USAGE RESULTS")
-	analyseCpuTimes()
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "gate" {
+		err = runGate(os.Args[2:], os.Stdout)
+	} else {
+		err = run(os.Args[1:], os.Stdout)
+	}
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
 }
@@ -14,15 +14,21 @@ go test -c -o gameoflife.test
 echo "Benchmarking..."
 
 benchtime=10x
+# Each benchmark is run several times so that compare can tell real differences from noise
+count=5
 
-#for b in 128x128x2 128x128x4 128x128x8 512x512x2 512x512x4 512x512x8
-for b in 128x128x2 128x128x4 128x128x8
+for run in $(seq ${count})
 do
-    echo ${b} on your solution
-    \time -f '%P' -o your-time.txt -a ./gameoflife.test -test.run XXX -test.bench /${b} -test.benchtime ${benchtime} >> your-out.txt
-    echo ${b} on baseline solution
-    \time -f '%P' -o base-time.txt -a ./baseline.test -test.run XXX -test.bench /${b} -test.benchtime ${benchtime} >> base-out.txt
+    #for b in 128x128x2 128x128x4 128x128x8 512x512x2 512x512x4 512x512x8
+    for b in 128x128x2 128x128x4 128x128x8
+    do
+        echo "${b} on your solution (run ${run} of ${count})"
+        \time -f "${b} %P" -o your-time.txt -a ./gameoflife.test -test.run XXX -test.bench /${b} -test.benchtime ${benchtime} >> your-out.txt
+        echo "${b} on baseline solution (run ${run} of ${count})"
+        \time -f "${b} %P" -o base-time.txt -a ./baseline.test -test.run XXX -test.bench /${b} -test.benchtime ${benchtime} >> base-out.txt
+    done
 done
 
-go build comparison/compare.go
-./compare base-time.txt your-time.txt base-out.txt your-out.txt
\ No newline at end of file
+go build -o compare ./comparison
+# Add -format markdown or -format json for other output formats
+./compare -cpu base-time.txt,your-time.txt base-out.txt your-out.txt
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"-format", "markdown", "-cpu", "testdata/base-time.txt,testdata/new-time.txt",
+		"testdata/base.txt", "testdata/new.txt"}, &out))
+	assert.Contains(t, out.String(), "| 128x128x2 | 193 ± 1.6% | 361 ± 2.9% | +87.0% | <0.001 |")
+
+	for name, args := range map[string][]string{
+		"no files":      {},
+		"one file":      {"testdata/base.txt"},
+		"missing file":  {"testdata/base.txt", "testdata/missing.txt"},
+		"format":        {"-format", "html", "testdata/base.txt", "testdata/new.txt"},
+		"alpha":         {"-alpha", "2", "testdata/base.txt", "testdata/new.txt"},
+		"one cpu file":  {"-cpu", "testdata/base-time.txt", "testdata/base.txt", "testdata/new.txt"},
+		"bad cpu file":  {"-cpu", "testdata/base.txt,testdata/new.txt", "testdata/base.txt", "testdata/new.txt"},
+		"no benchmarks": {"testdata/base-time.txt", "testdata/new-time.txt"},
+	} {
+		assert.Error(t, run(args, &bytes.Buffer{}), name)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Verdicts of the regression gate on each benchmark.
+const (
+	verdictOK        = "ok"
+	verdictRegressed = "REGRESSED"
+	verdictMissing   = "MISSING"
+	verdictNew       = "new"
+)
+
+// gateResult is the verdict of the regression gate on one benchmark.
+type gateResult struct {
+	comparison
+	tolerance float64
+	verdict   string
+}
+
+// failed reports whether the benchmark should fail the gate.
+func (r gateResult) failed() bool {
+	return r.verdict == verdictRegressed || r.verdict == verdictMissing
+}
+
+// readTolerances reads how much slower each benchmark may get, as a percentage, one benchmark per line such as
+//
+//	512x512x8 15
+//
+// Blank lines and lines starting with # are ignored.
+func readTolerances(r io.Reader) (map[string]float64, error) {
+	tolerances := map[string]float64{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a benchmark name and a tolerance, got %q", line, text)
+		}
+		tolerance, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if tolerance < 0 {
+			return nil, fmt.Errorf("line %d: tolerance must not be negative", line)
+		}
+		tolerances[benchName(fields[0])] = tolerance
+	}
+	return tolerances, scanner.Err()
+}
+
+// higherIsBetter reports whether bigger results in unit are an improvement, as for rates like MB/s.
+// Every other unit go test reports, like ns/op or allocs/op, is one where bigger is worse.
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+// worsened reports whether the mean of c got worse by more than tolerance percent.
+func worsened(c comparison, tolerance float64) bool {
+	if higherIsBetter(c.Unit) {
+		return c.New.Mean < c.Base.Mean*(1-tolerance/100)
+	}
+	return c.New.Mean > c.Base.Mean*(1+tolerance/100)
+}
+
+// checkRegressions compares new results against the baseline. A benchmark regresses if its mean gets worse by
+// more than its tolerance percentage, growing for most units but shrinking for rates, and the change is
+// significant at alpha when there are enough runs to tell. A baseline benchmark missing from the new results
+// fails too, as it can't be checked.
+func checkRegressions(base, new []bench, tolerances map[string]float64, tolerance, alpha float64) []gateResult {
+	var results []gateResult
+	for _, c := range compareBenchmarks(base, new, alpha) {
+		r := gateResult{comparison: c, tolerance: tolerance, verdict: verdictOK}
+		if t, ok := tolerances[c.Name]; ok {
+			r.tolerance = t
+		}
+		switch {
+		case c.New == nil:
+			r.verdict = verdictMissing
+		case c.Base == nil:
+			r.verdict = verdictNew
+		case worsened(c, r.tolerance) && (c.P == nil || c.Significant):
+			r.verdict = verdictRegressed
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// noinspection GoUnhandledErrorResult
+func writeGate(out io.Writer, results []gateResult) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "Benchmark\tUnit\tBaseline\tNew\tChange\tTolerance\tVerdict")
+	for _, r := range results {
+		change := "-"
+		if r.Delta != nil {
+			change = fmt.Sprintf("%+.1f%%", *r.Delta)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%g%%\t%s\n", r.Name, r.Unit,
+			formatSummary(r.Base, r.Unit), formatSummary(r.New, r.Unit), change, r.tolerance, r.verdict)
+	}
+	return w.Flush()
+}
+
+// runBenchmarks runs the benchmarks of the package in dir matching pattern and returns what go test printed.
+func runBenchmarks(dir, pattern, benchtime string, count int) ([]byte, error) {
+	cmd := exec.Command("go", "test", "-run", "XXX", "-bench", pattern,
+		"-benchtime", benchtime, "-count", strconv.Itoa(count))
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go test -bench %s: %v", pattern, err)
+	}
+	return output, nil
+}
+
+// defaultBaseline is where the baseline is stored, in the directory of the benchmarked package.
+// The timings depend on the machine, so each machine records its own and it isn't committed.
+// It can't be under baseline/, as the compare script builds a binary of that name.
+const defaultBaseline = "bench-baseline.txt"
+
+// runGate runs the benchmarks, or reads results that were already run, and checks them against the baseline.
+// With -record the results become the new baseline instead.
+func runGate(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("compare gate", flag.ContinueOnError)
+	baselinePath := flags.String("baseline", "", "Stored baseline results, defaulting to "+defaultBaseline+" in -dir.")
+	tolerance := flags.Float64("tolerance", 10, "Percentage a benchmark may get worse by before the gate fails.")
+	tolerancesPath := flags.String("tolerances", "", "File of per-benchmark tolerances, overriding -tolerance.")
+	alpha := flags.Float64("alpha", 0.05, "Largest p-value at which a regression counts as significant.")
+	resultsPath := flags.String("results", "", "Read go test -bench output from this file instead of running the benchmarks.")
+	record := flags.Bool("record", false, "Store the results as the new baseline instead of checking them.")
+	dir := flags.String("dir", ".", "Directory of the package to benchmark.")
+	pattern := flags.String("bench", "/128x128", "Benchmarks to run, as for go test -bench.")
+	benchtime := flags.String("benchtime", "10x", "Time or iterations of each run, as for go test -benchtime.")
+	count := flags.Int("count", 5, "Number of runs of each benchmark.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *baselinePath == "" {
+		*baselinePath = filepath.Join(*dir, defaultBaseline)
+	}
+	if *tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative, got %g", *tolerance)
+	}
+	if *alpha <= 0 || *alpha >= 1 {
+		return fmt.Errorf("alpha must be between 0 and 1, got %g", *alpha)
+	}
+	if *count < 1 {
+		return fmt.Errorf("count must be at least 1, got %d", *count)
+	}
+
+	var output []byte
+	var err error
+	if *resultsPath != "" {
+		output, err = ioutil.ReadFile(*resultsPath)
+	} else {
+		fmt.Fprintf(os.Stderr, "Running benchmarks %s %d times...\n", *pattern, *count)
+		output, err = runBenchmarks(*dir, *pattern, *benchtime, *count)
+	}
+	if err != nil {
+		return err
+	}
+	new, err := readBenchmarks(bytes.NewReader(output))
+	if err != nil {
+		return err
+	}
+	if len(new) == 0 {
+		return fmt.Errorf("no benchmark results found")
+	}
+
+	if *record {
+		if err := os.MkdirAll(filepath.Dir(*baselinePath), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*baselinePath, output, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Recorded %d results as the baseline in %s\n", len(new), *baselinePath)
+		return nil
+	}
+
+	base, err := readFile(*baselinePath, readBenchmarks)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no baseline at %s, record one with -record", *baselinePath)
+	}
+	if err != nil {
+		return err
+	}
+	tolerances := map[string]float64{}
+	if *tolerancesPath != "" {
+		file, err := os.Open(*tolerancesPath)
+		if err != nil {
+			return err
+		}
+		tolerances, err = readTolerances(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *tolerancesPath, err)
+		}
+	}
+
+	results := checkRegressions(base, new, tolerances, *tolerance, *alpha)
+	if err := writeGate(stdout, results); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d benchmarks regressed or are missing", failed, len(results))
+	}
+	return nil
+}
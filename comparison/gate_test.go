@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTolerances(t *testing.T) {
+	tolerances, err := readTolerances(strings.NewReader("# Noisy on small boards\n16x16x8 25%\n\nBenchmark/512x512x8-4 5\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"16x16x8": 25, "512x512x8": 5}, tolerances)
+
+	for _, bad := range []string{"16x16x8\n", "16x16x8 lots\n", "16x16x8 -5\n", "16x16x8 5 10\n"} {
+		_, err := readTolerances(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+// runs returns a measurement of the named benchmark in ns/op for each value.
+func runs(name string, values ...float64) []bench {
+	return runsIn(name, "ns/op", values...)
+}
+
+func runsIn(name, unit string, values ...float64) []bench {
+	var benchmarks []bench
+	for _, v := range values {
+		benchmarks = append(benchmarks, bench{name: name, unit: unit, value: v})
+	}
+	return benchmarks
+}
+
+func TestCheckRegressions(t *testing.T) {
+	var base, new []bench
+	base = append(base, runs("same", 100, 101, 99)...)
+	new = append(new, runs("same", 100, 102, 98)...)
+	base = append(base, runs("slower", 100, 101, 99)...)
+	new = append(new, runs("slower", 120, 121, 119)...)
+	base = append(base, runs("tolerated", 100, 101, 99)...)
+	new = append(new, runs("tolerated", 120, 121, 119)...)
+	base = append(base, runs("noisy", 100, 101, 99)...)
+	new = append(new, runs("noisy", 60, 200, 100)...)
+	base = append(base, runs("once", 100)...)
+	new = append(new, runs("once", 115)...)
+	base = append(base, runs("gone", 100)...)
+	new = append(new, runs("added", 100)...)
+	// Rates are better the higher they are
+	base = append(base, runsIn("faster rate", "MB/s", 100, 101, 99)...)
+	new = append(new, runsIn("faster rate", "MB/s", 120, 121, 119)...)
+	base = append(base, runsIn("slower rate", "MB/s", 100, 101, 99)...)
+	new = append(new, runsIn("slower rate", "MB/s", 80, 81, 79)...)
+
+	results := checkRegressions(base, new, map[string]float64{"tolerated": 25}, 10, 0.05)
+	verdicts := map[string]string{}
+	for _, r := range results {
+		verdicts[r.Name] = r.verdict
+	}
+	assert.Equal(t, map[string]string{
+		"same":        verdictOK,
+		"slower":      verdictRegressed,
+		"tolerated":   verdictOK,
+		"noisy":       verdictOK,
+		"once":        verdictRegressed,
+		"gone":        verdictMissing,
+		"added":       verdictNew,
+		"faster rate": verdictOK,
+		"slower rate": verdictRegressed,
+	}, verdicts)
+	assert.Equal(t, 25.0, results[2].tolerance)
+}
+
+func TestRunGate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	baseline := filepath.Join(dir, "baseline", "benchmarks.txt")
+
+	err = runGate([]string{"-baseline", baseline, "-results", "testdata/base.txt"}, &bytes.Buffer{})
+	assert.Error(t, err, "no baseline yet")
+
+	var out bytes.Buffer
+	require.NoError(t, runGate([]string{"-baseline", baseline, "-results", "testdata/base.txt", "-record"}, &out))
+	assert.Equal(t, "Recorded 10 results as the baseline in "+baseline+"\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runGate([]string{"-baseline", baseline, "-results", "testdata/base.txt"}, &out))
+	assert.Contains(t, out.String(), "128x128x2   ns/op   120ms ± 1.7%")
+	assert.NotContains(t, out.String(), verdictRegressed)
+
+	// The new results don't have 512x512x8
+	out.Reset()
+	err = runGate([]string{"-baseline", baseline, "-results", "testdata/new.txt"}, &out)
+	assert.EqualError(t, err, "1 of 5 benchmarks regressed or are missing")
+	assert.Contains(t, out.String(), verdictMissing)
+
+	// With the baseline the other way round, 128x128x2 is twice as slow and 256x256x4 is missing
+	require.NoError(t, runGate([]string{"-baseline", baseline, "-results", "testdata/new.txt", "-record"}, &bytes.Buffer{}))
+	out.Reset()
+	err = runGate([]string{"-baseline", baseline, "-results", "testdata/base.txt"}, &out)
+	assert.EqualError(t, err, "2 of 5 benchmarks regressed or are missing")
+	assert.Contains(t, out.String(), "+100.0%   10%         "+verdictRegressed)
+
+	tolerances := filepath.Join(dir, "tolerances.txt")
+	require.NoError(t, ioutil.WriteFile(tolerances, []byte("128x128x2 150\n"), 0644))
+	out.Reset()
+	err = runGate([]string{"-baseline", baseline, "-results", "testdata/base.txt", "-tolerances", tolerances}, &out)
+	assert.EqualError(t, err, "1 of 5 benchmarks regressed or are missing")
+	assert.NotContains(t, out.String(), verdictRegressed)
+
+	for name, args := range map[string][]string{
+		"arguments":         {"-results", "testdata/base.txt", "extra"},
+		"tolerance":         {"-tolerance", "-1", "-results", "testdata/base.txt"},
+		"count":             {"-count", "0", "-results", "testdata/base.txt"},
+		"missing results":   {"-results", filepath.Join(dir, "missing.txt")},
+		"no results":        {"-baseline", baseline, "-results", "testdata/base-time.txt"},
+		"missing tolerance": {"-baseline", baseline, "-results", "testdata/base.txt", "-tolerances", filepath.Join(dir, "missing.txt")},
+	} {
+		assert.Error(t, runGate(args, &bytes.Buffer{}), name)
+	}
+}
+
+// TestDefaultBaseline checks that the committed baseline is where the gate looks for it by default.
+func TestDefaultBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = runGate([]string{"-dir", dir, "-results", "testdata/base.txt"}, &bytes.Buffer{})
+	assert.EqualError(t, err, "no baseline at "+filepath.Join(dir, defaultBaseline)+", record one with -record")
+
+	require.NoError(t, runGate([]string{"-dir", dir, "-results", "testdata/base.txt", "-record"}, &bytes.Buffer{}))
+	assert.FileExists(t, filepath.Join(dir, defaultBaseline))
+	var out bytes.Buffer
+	require.NoError(t, runGate([]string{"-dir", dir, "-results", "testdata/base.txt"}, &out))
+	assert.Contains(t, out.String(), "128x128x2")
+	assert.NotContains(t, out.String(), verdictMissing)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+)
+
+// comparison is how one benchmark measured in one unit changed between the baseline and the new runs.
+// Base or New is missing if the benchmark only appears in the other, and the change is missing
+// unless both are there.
+type comparison struct {
+	Name string   `json:"name"`
+	Unit string   `json:"unit"`
+	Base *summary `json:"base,omitempty"`
+	New  *summary `json:"new,omitempty"`
+	// Delta is the change in the mean as a percentage of the baseline mean.
+	Delta *float64 `json:"delta,omitempty"`
+	// P is the p-value of Welch's t-test, which needs at least two runs on each side.
+	P           *float64 `json:"p,omitempty"`
+	Significant bool     `json:"significant"`
+}
+
+type benchKey struct {
+	name, unit string
+}
+
+// groupBenchmarks collects the values of each benchmark in each unit.
+func groupBenchmarks(benchmarks []bench) map[benchKey][]float64 {
+	samples := map[benchKey][]float64{}
+	for _, b := range benchmarks {
+		key := benchKey{b.name, b.unit}
+		samples[key] = append(samples[key], b.value)
+	}
+	return samples
+}
+
+// compareBenchmarks matches the baseline and new measurements by name and unit and compares them.
+// A change is significant if its p-value is below alpha.
+func compareBenchmarks(base, new []bench, alpha float64) []comparison {
+	baseSamples, newSamples := groupBenchmarks(base), groupBenchmarks(new)
+
+	// Benchmarks are listed in the order they first appear
+	var order []benchKey
+	seen := map[benchKey]bool{}
+	for _, b := range append(append([]bench(nil), base...), new...) {
+		key := benchKey{b.name, b.unit}
+		if !seen[key] {
+			seen[key] = true
+			order = append(order, key)
+		}
+	}
+
+	// Keep each unit together, in the order the units first appear
+	var units []string
+	unitSeen := map[string]bool{}
+	for _, key := range order {
+		if !unitSeen[key.unit] {
+			unitSeen[key.unit] = true
+			units = append(units, key.unit)
+		}
+	}
+
+	var comparisons []comparison
+	for _, unit := range units {
+		for _, key := range order {
+			if key.unit != unit {
+				continue
+			}
+			c := comparison{Name: key.name, Unit: key.unit}
+			if xs, ok := baseSamples[key]; ok {
+				s := summarise(xs)
+				c.Base = &s
+			}
+			if xs, ok := newSamples[key]; ok {
+				s := summarise(xs)
+				c.New = &s
+			}
+			if c.Base != nil && c.New != nil {
+				if c.Base.Mean != 0 {
+					delta := (c.New.Mean - c.Base.Mean) / c.Base.Mean * 100
+					c.Delta = &delta
+				}
+				if p := welchTest(*c.Base, *c.New); p == p {
+					c.P = &p
+					c.Significant = p < alpha
+				}
+			}
+			comparisons = append(comparisons, c)
+		}
+	}
+	return comparisons
+}
+
+// formatValue writes a value in unit, as a duration if it is a time.
+func formatValue(v float64, unit string) string {
+	switch {
+	case unit == "ns/op":
+		for _, scale := range []struct {
+			size   float64
+			suffix string
+		}{{1e9, "s"}, {1e6, "ms"}, {1e3, "µs"}} {
+			if math.Abs(v) >= scale.size {
+				return fmt.Sprintf("%.4g%s", v/scale.size, scale.suffix)
+			}
+		}
+		return fmt.Sprintf("%.4gns", v)
+	case math.Abs(v) >= 1e4:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.4g", v)
+}
+
+// formatSummary writes a summary as its mean and its standard deviation as a percentage of the mean.
+func formatSummary(s *summary, unit string) string {
+	switch {
+	case s == nil:
+		return "-"
+	case s.N < 2 || s.Mean == 0:
+		return formatValue(s.Mean, unit)
+	}
+	return fmt.Sprintf("%s ± %.1f%%", formatValue(s.Mean, unit), s.Stddev/s.Mean*100)
+}
+
+// cells returns the columns of a comparison in a table.
+// A change that isn't significant is shown as ~, as it could just be noise.
+func (c comparison) cells() []string {
+	change, p := "-", "-"
+	if c.Delta != nil {
+		change = "~"
+		if c.Significant {
+			change = fmt.Sprintf("%+.1f%%", *c.Delta)
+		}
+	}
+	switch {
+	case c.P == nil:
+	case *c.P < 0.001:
+		p = "<0.001"
+	default:
+		p = fmt.Sprintf("%.3f", *c.P)
+	}
+	return []string{c.Name, formatSummary(c.Base, c.Unit), formatSummary(c.New, c.Unit), change, p}
+}
+
+// header returns the column titles of a table of comparisons in unit.
+func header(unit string) []string {
+	return []string{"Benchmark", "Baseline (" + unit + ")", "Yours (" + unit + ")", "Change", "p"}
+}
+
+// byUnit splits comparisons into runs with the same unit.
+func byUnit(comparisons []comparison) [][]comparison {
+	var tables [][]comparison
+	for i, c := range comparisons {
+		if i == 0 || c.Unit != comparisons[i-1].Unit {
+			tables = append(tables, nil)
+		}
+		tables[len(tables)-1] = append(tables[len(tables)-1], c)
+	}
+	return tables
+}
+
+const legend = "Values are the mean ± the standard deviation of every run. " +
+	"Change is shown as ~ unless it is significant at p < %g.\n"
+
+// noinspection GoUnhandledErrorResult
+func writeText(out io.Writer, comparisons []comparison, alpha float64) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	for i, table := range byUnit(comparisons) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, strings.Join(header(table[0].Unit), "\t"))
+		for _, c := range table {
+			fmt.Fprintln(w, strings.Join(c.cells(), "\t"))
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, legend, alpha)
+	return w.Flush()
+}
+
+func writeMarkdown(w io.Writer, comparisons []comparison, alpha float64) error {
+	var b strings.Builder
+	row := func(cells []string) {
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	for i, table := range byUnit(comparisons) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		row(header(table[0].Unit))
+		row([]string{"---", "---:", "---:", "---:", "---:"})
+		for _, c := range table {
+			row(c.cells())
+		}
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, legend, alpha)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeJSON(w io.Writer, comparisons []comparison) error {
+	if comparisons == nil {
+		comparisons = []comparison{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(comparisons)
+}
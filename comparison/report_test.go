@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleComparisons compares the sample benchmark output in testdata.
+func sampleComparisons(t *testing.T) []comparison {
+	base, new, err := readPair("testdata/base.txt", "testdata/new.txt", readBenchmarks)
+	require.NoError(t, err)
+	return compareBenchmarks(base, new, 0.05)
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	comparisons := sampleComparisons(t)
+	var names []string
+	for _, c := range comparisons {
+		names = append(names, c.Name)
+	}
+	// Matched by name even though the new runs are in a different order
+	assert.Equal(t, []string{"128x128x2", "128x128x4", "128x128x8", "512x512x8", "256x256x4"}, names)
+
+	faster := comparisons[0]
+	require.NotNil(t, faster.Base)
+	require.NotNil(t, faster.New)
+	assert.Equal(t, 3, faster.Base.N)
+	assert.Equal(t, 120e6, faster.Base.Mean)
+	assert.Equal(t, 60e6, faster.New.Mean)
+	assert.Equal(t, -50.0, *faster.Delta)
+	assert.True(t, faster.Significant)
+
+	same := comparisons[1]
+	assert.Equal(t, 0.0, *same.Delta)
+	assert.False(t, same.Significant)
+
+	baseOnly, newOnly := comparisons[3], comparisons[4]
+	assert.Nil(t, baseOnly.New)
+	assert.Nil(t, baseOnly.Delta)
+	assert.Nil(t, baseOnly.P)
+	assert.Nil(t, newOnly.Base)
+	assert.Equal(t, 3, newOnly.New.N)
+
+	// A single run on each side can't be tested for significance
+	single := compareBenchmarks([]bench{{"a", "ns/op", 10}}, []bench{{"a", "ns/op", 5}}, 0.05)
+	require.Len(t, single, 1)
+	assert.Equal(t, -50.0, *single[0].Delta)
+	assert.Nil(t, single[0].P)
+	assert.False(t, single[0].Significant)
+}
+
+func TestCompareBenchmarksGroupsUnits(t *testing.T) {
+	base := []bench{{"a", "ns/op", 1}, {"a", cpuUnit, 100}, {"b", "ns/op", 2}}
+	comparisons := compareBenchmarks(base, base, 0.05)
+	require.Len(t, comparisons, 3)
+	assert.Equal(t, []string{"ns/op", "ns/op", cpuUnit},
+		[]string{comparisons[0].Unit, comparisons[1].Unit, comparisons[2].Unit})
+	assert.Len(t, byUnit(comparisons), 2)
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "120ms", formatValue(120e6, "ns/op"))
+	assert.Equal(t, "1.235s", formatValue(1234567890, "ns/op"))
+	assert.Equal(t, "12.5µs", formatValue(12500, "ns/op"))
+	assert.Equal(t, "512.5ns", formatValue(512.5, "ns/op"))
+	assert.Equal(t, "385.5", formatValue(385.5, cpuUnit))
+	assert.Equal(t, "1048576", formatValue(1<<20, "B/op"))
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeText(&buf, sampleComparisons(t), 0.05))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "Benchmark   Baseline (ns/op)   Yours (ns/op)   Change   p", lines[0])
+	assert.Equal(t, "128x128x2   120ms ± 1.7%       60ms ± 1.7%     -50.0%   <0.001", lines[1])
+	assert.Equal(t, "128x128x4   80ms ± 1.2%        80ms ± 2.5%     ~        1.000", lines[2])
+	assert.Equal(t, "512x512x8   900ms              -               -        -", lines[4])
+	assert.Contains(t, buf.String(), "p < 0.05")
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeMarkdown(&buf, sampleComparisons(t), 0.05))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "| Benchmark | Baseline (ns/op) | Yours (ns/op) | Change | p |", lines[0])
+	assert.Equal(t, "| --- | ---: | ---: | ---: | ---: |", lines[1])
+	assert.Equal(t, "| 128x128x2 | 120ms ± 1.7% | 60ms ± 1.7% | -50.0% | <0.001 |", lines[2])
+	assert.Equal(t, "| 256x256x4 | - | 305ms ± 1.6% | - | - |", lines[6])
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeJSON(&buf, sampleComparisons(t)))
+	var decoded []map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(t, decoded, 5)
+	assert.Equal(t, "128x128x2", decoded[0]["name"])
+	assert.Equal(t, "ns/op", decoded[0]["unit"])
+	assert.Equal(t, -50.0, decoded[0]["delta"])
+	assert.Equal(t, true, decoded[0]["significant"])
+	assert.Equal(t, 120e6, decoded[0]["base"].(map[string]interface{})["mean"])
+	assert.NotContains(t, decoded[3], "new")
+	assert.NotContains(t, decoded[3], "p")
+
+	buf.Reset()
+	require.NoError(t, writeJSON(&buf, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
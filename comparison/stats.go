@@ -0,0 +1,104 @@
+package main
+
+import "math"
+
+// summary describes the samples of one benchmark.
+type summary struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+}
+
+// summarise returns the mean and sample standard deviation of xs.
+func summarise(xs []float64) summary {
+	s := summary{N: len(xs)}
+	if s.N == 0 {
+		return s
+	}
+	for _, x := range xs {
+		s.Mean += x
+	}
+	s.Mean /= float64(s.N)
+	if s.N > 1 {
+		for _, x := range xs {
+			s.Stddev += (x - s.Mean) * (x - s.Mean)
+		}
+		s.Stddev = math.Sqrt(s.Stddev / float64(s.N-1))
+	}
+	return s
+}
+
+// welchTest returns the two-sided p-value of Welch's t-test, which is how likely a difference in means at least
+// as big as the one between a and b is if both come from distributions with the same mean.
+// It needs at least two samples of each, and returns NaN otherwise.
+func welchTest(a, b summary) float64 {
+	if a.N < 2 || b.N < 2 {
+		return math.NaN()
+	}
+	va, vb := a.Stddev*a.Stddev/float64(a.N), b.Stddev*b.Stddev/float64(b.N)
+	if va+vb == 0 {
+		if a.Mean == b.Mean {
+			return 1
+		}
+		return 0
+	}
+	t := (a.Mean - b.Mean) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/float64(a.N-1) + vb*vb/float64(b.N-1))
+	return incompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// incompleteBeta is the regularised incomplete beta function I_x(a, b).
+func incompleteBeta(x, a, b float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly only on one side of the mean, so use the symmetry on the other
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(1-x, b, a)/b
+	}
+	return front * betaFraction(x, a, b) / a
+}
+
+// betaFraction evaluates the continued fraction for the incomplete beta function with Lentz's method.
+func betaFraction(x, a, b float64) float64 {
+	const (
+		epsilon = 1e-14
+		tiny    = 1e-300
+		maxTerm = 300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	f := d
+	for m := 1; m <= maxTerm; m++ {
+		m := float64(m)
+		for _, num := range []float64{
+			m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m)),
+			-(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			f *= c * d
+		}
+		if math.Abs(c*d-1) < epsilon {
+			break
+		}
+	}
+	return f
+}
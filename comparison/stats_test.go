@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarise(t *testing.T) {
+	assert.Equal(t, summary{}, summarise(nil))
+	assert.Equal(t, summary{N: 1, Mean: 7}, summarise([]float64{7}))
+
+	s := summarise([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	assert.Equal(t, 8, s.N)
+	assert.Equal(t, 5.0, s.Mean)
+	assert.InDelta(t, math.Sqrt(32.0/7), s.Stddev, 1e-12)
+}
+
+func TestIncompleteBeta(t *testing.T) {
+	for _, test := range []struct {
+		x, a, b, want float64
+	}{
+		{0, 2, 3, 0},
+		{1, 2, 3, 1},
+		{0.5, 1, 1, 0.5},
+		{0.5, 2, 3, 0.6875},
+		{0.2, 2, 3, 0.1808},
+		{0.9, 0.5, 0.5, 2 / math.Pi * math.Asin(math.Sqrt(0.9))},
+	} {
+		assert.InDelta(t, test.want, incompleteBeta(test.x, test.a, test.b), 1e-10, "I_%g(%g, %g)", test.x, test.a, test.b)
+	}
+}
+
+func TestWelchTest(t *testing.T) {
+	a := summarise([]float64{1, 2, 3, 4, 5})
+	b := summarise([]float64{3, 4, 5, 6, 7})
+	// t = -2 with 8 degrees of freedom
+	assert.InDelta(t, 0.0805, welchTest(a, b), 1e-4)
+	assert.InDelta(t, welchTest(a, b), welchTest(b, a), 1e-12)
+	assert.Equal(t, 1.0, welchTest(a, a))
+
+	// Unequal variances and sizes, checked by integrating the t distribution numerically
+	c := summarise([]float64{19.1, 21.3, 20.2, 22.5, 18.7, 20.9})
+	d := summarise([]float64{24.3, 30.1, 27.8})
+	assert.InDelta(t, 0.041715, welchTest(c, d), 1e-6)
+
+	assert.True(t, math.IsNaN(welchTest(summarise([]float64{1}), b)))
+	assert.Equal(t, 1.0, welchTest(summarise([]float64{3, 3}), summarise([]float64{3, 3, 3})))
+	assert.Equal(t, 0.0, welchTest(summarise([]float64{3, 3}), summarise([]float64{4, 4})))
+}
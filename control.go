@@ -6,6 +6,15 @@ import (
 	"github.com/nsf/termbox-go"
 )
 
+// Special keys as they are sent on the key chan by getKeyboardCommand.
+const (
+	keyUp    = rune(termbox.KeyArrowUp)
+	keyDown  = rune(termbox.KeyArrowDown)
+	keyLeft  = rune(termbox.KeyArrowLeft)
+	keyRight = rune(termbox.KeyArrowRight)
+	keyEsc   = rune(termbox.KeyEsc)
+)
+
 // getKeyboardCommand sends all keys pressed on the keyboard as runes (characters) on the key chan.
 // getKeyboardCommand will NOT work if termbox isn't initialised (in startControlServer)
 func getKeyboardCommand(key chan<- rune) {
@@ -22,13 +31,15 @@ func getKeyboardCommand(key chan<- rune) {
 }
 
 // startControlServer initialises termbox and prints basic information about the game configuration.
-func startControlServer(p golParams) {
-	e := termbox.Init()
-	check(e)
+func startControlServer(p golParams) error {
+	if err := termbox.Init(); err != nil {
+		return err
+	}
 
-	fmt.Println("Threads:", p.threads)
-	fmt.Println("Width:", p.imageWidth)
-	fmt.Println("Height:", p.imageHeight)
+	fmt.Fprintln(p.messages(), "Threads:", p.threads)
+	fmt.Fprintln(p.messages(), "Width:", p.imageWidth)
+	fmt.Fprintln(p.messages(), "Height:", p.imageHeight)
+	return nil
 }
 
 // StopControlServer closes termbox.
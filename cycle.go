@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// zobristSeed makes the keys of one cell unrelated to those of its neighbours.
+const zobristSeed = 0x9E3779B97F4A7C15
+
+// zobristKey returns the random key of the cell at (x, y). The hash of a world is the XOR of the keys of its alive
+// cells, so flipping a cell changes the hash by its key. Keys are computed rather than kept in a table, which would
+// need 8 bytes for every cell of the board.
+func zobristKey(x, y, width int) uint64 {
+	// splitmix64
+	z := uint64(y)*uint64(width) + uint64(x) + zobristSeed
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
+}
+
+// worldHash returns the Zobrist hash of the given rows of a world, where the first row is row top of the board.
+func worldHash(rows [][]byte, top, width int) uint64 {
+	var hash uint64
+	for y, row := range rows {
+		for x, v := range row {
+			if v != 0 {
+				hash ^= zobristKey(x, top+y, width)
+			}
+		}
+	}
+	return hash
+}
+
+// flipsHash returns the XOR of the keys of every cell that differs between two versions of the same rows,
+// which turns the hash of before into the hash of after.
+func flipsHash(before, after [][]byte, top, width int) uint64 {
+	var hash uint64
+	for y := range before {
+		for x := range before[y] {
+			if before[y][x] != after[y][x] {
+				hash ^= zobristKey(x, top+y, width)
+			}
+		}
+	}
+	return hash
+}
+
+// workerHash is how a worker reports the hash of its rows after each turn.
+// A nil *workerHash means cycles aren't being looked for.
+type workerHash struct {
+	top    int         // Row of the board that the worker's first row is
+	hashes chan uint64 // Buffered, so that the worker can start its next command straight away
+}
+
+// cycle is a world that has been seen before.
+type cycle struct {
+	start  int // Turn the world was first seen, from when it repeats forever
+	period int // 1 for a still life
+}
+
+func (c cycle) String() string {
+	if c.period == 1 {
+		return fmt.Sprintf("still life from turn %d", c.start)
+	}
+	return fmt.Sprintf("oscillating with period %d from turn %d", c.period, c.start)
+}
+
+// checkpointTurns is the fewest turns between the worlds a cycleDetector keeps, so that fetching them from the
+// workers costs little. Checking a repeated hash replays at most this many turns plus the limit from one of them.
+const checkpointTurns = 64
+
+// cycleDetector remembers the hashes of the worlds of the last few turns to find one that repeats.
+// Two worlds can share a hash, so it also keeps a world every so often, from which the world of a repeated hash
+// can be played again and compared before a cycle is reported.
+type cycleDetector struct {
+	limit       int            // Longest period looked for
+	turns       map[uint64]int // Latest turn each remembered hash was seen
+	recent      []seenHash     // Remembered hashes in the order they were seen
+	checkpoints []checkpoint   // The last two worlds kept, oldest first
+	found       bool           // Whether a cycle has been found since the last reset, after which nothing more is looked for
+}
+
+type seenHash struct {
+	turn int
+	hash uint64
+}
+
+// checkpoint is a copy of the world after turn.
+type checkpoint struct {
+	turn  int
+	world [][]byte
+}
+
+func newCycleDetector(limit int) *cycleDetector {
+	d := &cycleDetector{limit: limit}
+	d.reset()
+	return d
+}
+
+// reset forgets every world, for when the world is changed by something other than a turn.
+func (d *cycleDetector) reset() {
+	d.turns = make(map[uint64]int, d.limit)
+	d.recent = nil
+	d.checkpoints = nil
+	d.found = false
+}
+
+// wantsCheckpoint reports whether the world after turn should be kept with checkpoint.
+func (d *cycleDetector) wantsCheckpoint(turn int) bool {
+	interval := d.limit
+	if interval < checkpointTurns {
+		interval = checkpointTurns
+	}
+	n := len(d.checkpoints)
+	return n == 0 || turn-d.checkpoints[n-1].turn >= interval
+}
+
+// checkpoint keeps a copy of the world after turn. Only the one before it is kept as well, which is enough for
+// any turn the limit reaches back to, as checkpoints are at least the limit apart.
+func (d *cycleDetector) checkpoint(turn int, world [][]byte) {
+	c := checkpoint{turn: turn, world: make([][]byte, len(world))}
+	for y := range world {
+		c.world[y] = append([]byte(nil), world[y]...)
+	}
+	d.checkpoints = append(d.checkpoints, c)
+	if n := len(d.checkpoints); n > 2 {
+		d.checkpoints = d.checkpoints[n-2:]
+	}
+}
+
+// replay returns the world after turn, played from the latest checkpoint before it,
+// or false if there is no such checkpoint.
+func (d *cycleDetector) replay(turn int) ([][]byte, bool) {
+	for i := len(d.checkpoints) - 1; i >= 0; i-- {
+		c := d.checkpoints[i]
+		if c.turn > turn {
+			continue
+		}
+		world := c.world
+		for t := c.turn; t < turn; t++ {
+			world = makeTurn(world, len(world), len(world[0]))
+		}
+		return world, true
+	}
+	return nil, false
+}
+
+// add records the hash of the world after turn and returns the cycle it completes, if it is the first one found.
+// same is asked whether the world after turn really is the one after the earlier turn with the same hash,
+// so that a cycle is never reported for two different worlds that only share a hash.
+func (d *cycleDetector) add(turn int, hash uint64, same func(seen int) bool) (cycle, bool) {
+	if d.found {
+		return cycle{}, false
+	}
+	if seen, ok := d.turns[hash]; ok && turn-seen <= d.limit && same(seen) {
+		d.found = true
+		return cycle{start: seen, period: turn - seen}, true
+	}
+	d.recent = append(d.recent, seenHash{turn, hash})
+	d.turns[hash] = turn
+
+	// Forget worlds too long ago for the next turn to repeat them within the limit
+	for d.recent[0].turn <= turn-d.limit {
+		if old := d.recent[0]; d.turns[old.hash] == old.turn {
+			delete(d.turns, old.hash)
+		}
+		d.recent = d.recent[1:]
+	}
+	return cycle{}, false
+}
+
+// collectHash waits for every worker to report the hash of its rows and returns the hash of the whole world.
+func (s *distributorState) collectHash() uint64 {
+	var hash uint64
+	for _, hashes := range s.d.hashes {
+		hash ^= <-hashes
+	}
+	return hash
+}
+
+// sameWorld reports whether the world now is the same as it was after the earlier turn seen,
+// which is played again from one of the cycle detector's checkpoints.
+func (s *distributorState) sameWorld(seen int) bool {
+	before, ok := s.cycles.replay(seen)
+	if !ok {
+		return false
+	}
+	if s.stale {
+		s.fetchWorld()
+	}
+	for y := range before {
+		if !bytes.Equal(before[y], s.world[y]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkCycle reports the first time the world after a turn repeats an earlier one, and stops the game if p.cycleStop.
+func (s *distributorState) checkCycle(hash uint64) {
+	if s.cycles.wantsCheckpoint(s.turn) {
+		if s.stale {
+			s.fetchWorld()
+		}
+		s.cycles.checkpoint(s.turn, s.world)
+	}
+	c, ok := s.cycles.add(s.turn, hash, s.sameWorld)
+	if !ok {
+		return
+	}
+	e := CycleDetected{CompletedTurns: s.turn, Start: c.start, Period: c.period}
+	fmt.Fprintln(s.p.messages(), e)
+	s.emit(e)
+	if s.p.cycleStop {
+		s.setState(STOP)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Patterns used to test cycle detection, each near the top left of its board.
+var (
+	block   = []cell{{1, 1}, {2, 1}, {1, 2}, {2, 2}}
+	blinker = []cell{{1, 2}, {2, 2}, {3, 2}}
+	glider  = []cell{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}}
+	// Three cells of a block, which becomes the block after a turn
+	preBlock = []cell{{1, 1}, {2, 1}, {1, 2}}
+)
+
+// pulsar returns the cells of a pulsar, which has period 3, with its top left corner at (at, at).
+func pulsar(at int) []cell {
+	var cells []cell
+	for _, line := range []int{0, 5, 7, 12} {
+		for _, along := range []int{2, 3, 4, 8, 9, 10} {
+			cells = append(cells, cell{x: at + along, y: at + line}, cell{x: at + line, y: at + along})
+		}
+	}
+	return cells
+}
+
+func TestZobristHash(t *testing.T) {
+	c := soupCase{width: 9, height: 7, alive: []cell{{0, 0}, {8, 6}, {3, 2}, {4, 2}, {5, 2}}}
+	before := testWorld(c.width, c.height, c.alive...)
+	after := referenceStep(before, c.width, c.height)
+
+	assert.Equal(t, uint64(0), worldHash(testWorld(c.width, c.height), 0, c.width))
+	assert.Equal(t, zobristKey(0, 0, c.width)^zobristKey(8, 6, c.width)^zobristKey(3, 2, c.width)^
+		zobristKey(4, 2, c.width)^zobristKey(5, 2, c.width), worldHash(before, 0, c.width))
+	assert.Equal(t, worldHash(after, 0, c.width), worldHash(before, 0, c.width)^flipsHash(before, after, 0, c.width))
+
+	// Hashing the rows in parts, as the workers do, gives the hash of the whole world
+	assert.Equal(t, worldHash(before, 0, c.width), worldHash(before[:3], 0, c.width)^worldHash(before[3:], 3, c.width))
+	assert.Equal(t, flipsHash(before, after, 0, c.width),
+		flipsHash(before[:3], after[:3], 0, c.width)^flipsHash(before[3:], after[3:], 3, c.width))
+
+	// Every cell of a board has a different key
+	keys := make(map[uint64]bool)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			keys[zobristKey(x, y, 64)] = true
+		}
+	}
+	assert.Len(t, keys, 64*64)
+}
+
+func TestCycleDetector(t *testing.T) {
+	same := func(int) bool { return true }
+	d := newCycleDetector(2)
+	for turn, hash := range []uint64{1, 2, 3, 1, 4} {
+		_, ok := d.add(turn, hash, same)
+		assert.False(t, ok, "1 repeats after 3 turns, which is longer than the limit")
+	}
+
+	_, ok := d.add(5, 3, same)
+	assert.False(t, ok)
+	c, ok := d.add(6, 4, same)
+	require.True(t, ok)
+	assert.Equal(t, cycle{start: 4, period: 2}, c)
+	assert.Equal(t, "oscillating with period 2 from turn 4", c.String())
+	_, ok = d.add(7, 3, same)
+	assert.False(t, ok, "only the first cycle should be reported")
+
+	d.reset()
+	_, ok = d.add(7, 4, same)
+	assert.False(t, ok, "worlds from before a reset should be forgotten")
+	c, ok = d.add(8, 4, same)
+	require.True(t, ok)
+	assert.Equal(t, "still life from turn 7", c.String())
+
+	// Different worlds with the same hash are not a cycle, and the later one is what a repeat is checked against
+	d.reset()
+	d.add(1, 5, same)
+	_, ok = d.add(2, 5, func(seen int) bool {
+		assert.Equal(t, 1, seen)
+		return false
+	})
+	assert.False(t, ok, "a hash collision should not be reported")
+	c, ok = d.add(3, 5, func(seen int) bool { return seen == 2 })
+	require.True(t, ok)
+	assert.Equal(t, cycle{start: 2, period: 1}, c)
+}
+
+func TestCycleCheckpoints(t *testing.T) {
+	d := newCycleDetector(2)
+	assert.True(t, d.wantsCheckpoint(3))
+	world := testWorld(8, 8, blinker...)
+	d.checkpoint(3, world)
+	assert.False(t, d.wantsCheckpoint(3+checkpointTurns-1))
+	assert.True(t, d.wantsCheckpoint(3+checkpointTurns))
+
+	_, ok := d.replay(2)
+	assert.False(t, ok, "there is nothing to replay turns before the first checkpoint from")
+	replayed, ok := d.replay(4)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []cell{{2, 1}, {2, 2}, {2, 3}}, aliveCells(replayed))
+	replayed, ok = d.replay(5)
+	require.True(t, ok)
+	assert.Equal(t, world, replayed)
+
+	// Only the last two checkpoints are kept
+	d.checkpoint(100, testWorld(8, 8))
+	d.checkpoint(200, testWorld(8, 8, block...))
+	_, ok = d.replay(50)
+	assert.False(t, ok)
+	replayed, ok = d.replay(150)
+	require.True(t, ok)
+	assert.Empty(t, aliveCells(replayed))
+	d.reset()
+	_, ok = d.replay(250)
+	assert.False(t, ok, "checkpoints from before a reset should be forgotten")
+}
+
+// playCycles plays c looking for cycles of up to limit turns and returns the cycles found and the final turn.
+func playCycles(t *testing.T, c soupCase, limit int, stop bool) ([]CycleDetected, int) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p, err := c.writeInput(dir)
+	require.NoError(t, err)
+	p.cycleLimit = limit
+	p.cycleStop = stop
+
+	events, _ := collectEvents(t, p)
+	var cycles []CycleDetected
+	final := -1
+	for _, e := range events {
+		switch e := e.(type) {
+		case CycleDetected:
+			cycles = append(cycles, e)
+		case FinalTurnComplete:
+			final = e.CompletedTurns
+		}
+	}
+	return cycles, final
+}
+
+func TestCycleDetection(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     soupCase
+		limit int
+		want  []CycleDetected
+	}{
+		{"block", soupCase{width: 8, height: 8, turns: 10, alive: block}, 1, []CycleDetected{{1, 0, 1}}},
+		{"pre-block", soupCase{width: 8, height: 8, turns: 10, alive: preBlock}, 1, []CycleDetected{{2, 1, 1}}},
+		{"blinker", soupCase{width: 8, height: 8, turns: 10, alive: blinker}, 2, []CycleDetected{{2, 0, 2}}},
+		{"blinker over limit", soupCase{width: 8, height: 8, turns: 10, alive: blinker}, 1, nil},
+		{"pulsar", soupCase{width: 32, height: 32, turns: 10, alive: pulsar(9)}, 8, []CycleDetected{{3, 0, 3}}},
+		// A glider on a torus comes back to where it started after crossing the board once
+		{"glider", soupCase{width: 16, height: 16, turns: 100, alive: glider}, 64, []CycleDetected{{64, 0, 64}}},
+		{"glider over limit", soupCase{width: 16, height: 16, turns: 100, alive: glider}, 63, nil},
+		{"glider before repeating", soupCase{width: 16, height: 16, turns: 63, alive: glider}, 64, nil},
+	}
+	for _, test := range tests {
+		for _, threads := range []int{1, 3, 8} {
+			c := test.c
+			c.threads = threads
+			cycles, final := playCycles(t, c, test.limit, false)
+			assert.Equal(t, test.want, cycles, "%s with %d threads", test.name, threads)
+			assert.Equal(t, c.turns, final, "%s with %d threads should play every turn", test.name, threads)
+		}
+	}
+}
+
+func TestCycleStop(t *testing.T) {
+	c := soupCase{width: 16, height: 16, threads: 4, turns: 1000, alive: glider}
+	cycles, final := playCycles(t, c, 64, true)
+	assert.Equal(t, []CycleDetected{{64, 0, 64}}, cycles)
+	assert.Equal(t, 64, final, "the game should end on the turn the cycle is found")
+
+	c = soupCase{width: 16, height: 16, threads: 4, turns: 1000, alive: preBlock}
+	cycles, final = playCycles(t, c, 1, true)
+	assert.Equal(t, []CycleDetected{{2, 1, 1}}, cycles)
+	assert.Equal(t, 2, final, "the game should end on the turn the cycle is found")
+	assert.Equal(t, "Turn 2: still life from turn 1", fmt.Sprint(cycles[0]))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// pattern is a named shape that can be stamped into the world while paused.
+type pattern struct {
+	name  string
+	cells []cell
+}
+
+// parsePatternRows turns rows of '.' and 'O' into the alive cells of a pattern.
+func parsePatternRows(rows string) []cell {
+	var cells []cell
+	for y, row := range strings.Split(strings.TrimSpace(rows), "\n") {
+		for x, c := range strings.TrimSpace(row) {
+			if c == 'O' {
+				cells = append(cells, cell{x: x, y: y})
+			}
+		}
+	}
+	return cells
+}
+
+// patternLibrary holds the patterns that can be stamped, cycled through with '[' and ']'.
+var patternLibrary = []pattern{
+	{"glider", parsePatternRows(`
+		.O.
+		..O
+		OOO`)},
+	{"lwss", parsePatternRows(`
+		.O..O
+		O....
+		O...O
+		OOOO.`)},
+	{"blinker", parsePatternRows(`
+		OOO`)},
+	{"block", parsePatternRows(`
+		OO
+		OO`)},
+	{"beehive", parsePatternRows(`
+		.OO.
+		O..O
+		.OO.`)},
+	{"r-pentomino", parsePatternRows(`
+		.OO
+		OO.
+		.O.`)},
+	{"pulsar", parsePatternRows(`
+		..OOO...OOO..
+		.............
+		O....O.O....O
+		O....O.O....O
+		O....O.O....O
+		..OOO...OOO..
+		.............
+		..OOO...OOO..
+		O....O.O....O
+		O....O.O....O
+		O....O.O....O
+		.............
+		..OOO...OOO..`)},
+	{"gosper-gun", parsePatternRows(`
+		........................O...........
+		......................O.O...........
+		............OO......OO............OO
+		...........O...O....OO............OO
+		OO........O.....O...OO..............
+		OO........O...O.OO....O.O...........
+		..........O.....O.......O...........
+		...........O...O....................
+		............OO......................`)},
+}
+
+// editor holds the cursor and selection used to edit the world while paused.
+type editor struct {
+	cursor  cell
+	mark    cell
+	marked  bool
+	pattern int // Index into patternLibrary
+	rand    *rand.Rand
+}
+
+func newEditor() editor {
+	return editor{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// region returns the inclusive corners of the rectangle between the mark and the cursor,
+// or just the cursor if nothing is marked.
+func (e editor) region() (cell, cell) {
+	if !e.marked {
+		return e.cursor, e.cursor
+	}
+	min, max := e.mark, e.cursor
+	if min.x > max.x {
+		min.x, max.x = max.x, min.x
+	}
+	if min.y > max.y {
+		min.y, max.y = max.y, min.y
+	}
+	return min, max
+}
+
+// setCell changes a single cell of s.world, wrapping around the edges, and reports the flip.
+func (s *distributorState) setCell(x, y int, val byte) {
+	x = (x%s.p.imageWidth + s.p.imageWidth) % s.p.imageWidth
+	y = (y%s.p.imageHeight + s.p.imageHeight) % s.p.imageHeight
+	if s.world[y][x] == val {
+		return
+	}
+	s.world[y][x] = val
+	s.edits = append(s.edits, int32(y*s.p.imageWidth+x))
+	s.emit(CellFlipped{CompletedTurns: s.turn, Cell: cell{x: x, y: y}})
+}
+
+// handleEditKey applies an editing key, returning false if r isn't one.
+// Edits are only allowed while paused and are pushed to the workers straight away.
+//
+//	h j k l		move the cursor
+//	space		toggle the cell under the cursor
+//	[ ]			choose a pattern, o stamps it with its top left at the cursor
+//	m			mark a corner, the region is then the rectangle from the mark to the cursor
+//	c r			clear or randomise the region
+func (s *distributorState) handleEditKey(r rune) bool {
+	e := &s.editor
+	dot := 1 << uint(s.view.zoom)
+	moveCursor := func(dx, dy int) {
+		e.cursor.x = ((e.cursor.x+dx)%s.p.imageWidth + s.p.imageWidth) % s.p.imageWidth
+		e.cursor.y = ((e.cursor.y+dy)%s.p.imageHeight + s.p.imageHeight) % s.p.imageHeight
+	}
+
+	switch r {
+	case 'h', 'j', 'k', 'l', '[', ']', 'm', ' ', 'o', 'c', 'r':
+	default:
+		return false
+	}
+	if s.state != PAUSE {
+		return true
+	}
+
+	// Keys that don't change the world
+	switch r {
+	case 'h':
+		moveCursor(-dot, 0)
+		return true
+	case 'j':
+		moveCursor(0, dot)
+		return true
+	case 'k':
+		moveCursor(0, -dot)
+		return true
+	case 'l':
+		moveCursor(dot, 0)
+		return true
+	case '[':
+		e.pattern = (e.pattern - 1 + len(patternLibrary)) % len(patternLibrary)
+		return true
+	case ']':
+		e.pattern = (e.pattern + 1) % len(patternLibrary)
+		return true
+	case 'm':
+		e.marked = !e.marked
+		e.mark = e.cursor
+		return true
+	}
+
+	s.fetchWorld()
+	switch r {
+	case ' ':
+		if s.world[e.cursor.y][e.cursor.x] != 0 {
+			s.setCell(e.cursor.x, e.cursor.y, 0x00)
+		} else {
+			s.setCell(e.cursor.x, e.cursor.y, 0xFF)
+		}
+	case 'o':
+		for _, c := range patternLibrary[e.pattern].cells {
+			s.setCell(e.cursor.x+c.x, e.cursor.y+c.y, 0xFF)
+		}
+	case 'c', 'r':
+		min, max := e.region()
+		for y := min.y; y <= max.y; y++ {
+			for x := min.x; x <= max.x; x++ {
+				var val byte
+				if r == 'r' && e.rand.Intn(2) == 0 {
+					val = 0xFF
+				}
+				s.setCell(x, y, val)
+			}
+		}
+		e.marked = false
+	}
+	if s.history != nil && len(s.edits) > 0 {
+		s.history.push(historyEntry{turnBefore: s.turn, turnAfter: s.turn, flips: s.edits})
+	}
+	s.edits = nil
+	s.pushWorld()
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startEditTest runs a 16x16 game driven by the returned key and control chans.
+func startEditTest(t *testing.T) (chan rune, chan controlRequest, chan []cell) {
+	return startKeyTest(t, golParams{turns: 1000000000, threads: 4, imageWidth: 16, imageHeight: 16}, externalChans{})
+}
+
+func TestEditStampAndToggle(t *testing.T) {
+	key, _, finalAlive := startEditTest(t)
+
+	// Pause, clear the whole board from (0, 0) to (15, 15), then stamp a glider wrapping around the corner
+	sendKeys(key, "pmhkco q")
+	assert.ElementsMatch(t, []cell{
+		{x: 15, y: 15},
+		{x: 0, y: 15},
+		{x: 1, y: 0},
+		{x: 15, y: 1},
+		{x: 0, y: 1},
+		{x: 1, y: 1},
+	}, <-finalAlive)
+}
+
+func TestEditPushedToWorkers(t *testing.T) {
+	key, control, finalAlive := startEditTest(t)
+
+	// Clear the board and stamp a horizontal blinker at (4, 4)
+	sendKeys(key, "pmhkcjjjjjlllll]]o")
+
+	reply := make(chan controlResponse, 1)
+	control <- controlRequest{command: controlStep, n: 1, reply: reply}
+	<-reply
+
+	sendKeys(key, "q")
+	assert.ElementsMatch(t, []cell{{x: 5, y: 3}, {x: 5, y: 4}, {x: 5, y: 5}}, <-finalAlive)
+}
+
+func TestEditRandomiseRegion(t *testing.T) {
+	key, _, finalAlive := startEditTest(t)
+
+	// Clear the board, then randomise the 3x3 square from (2, 2) to (4, 4)
+	sendKeys(key, "pmhkcllljjjmlljjrq")
+	for _, c := range <-finalAlive {
+		assert.True(t, c.x >= 2 && c.x <= 4 && c.y >= 2 && c.y <= 4, "cell %v outside region", c)
+	}
+}
+
+func TestEditIgnoredWhileRunning(t *testing.T) {
+	key, control, finalAlive := startEditTest(t)
+
+	// Editing keys do nothing until the game is paused
+	sendKeys(key, "mhkc")
+	reply := make(chan controlResponse, 1)
+	control <- controlRequest{command: controlStatus, reply: reply}
+	assert.Equal(t, 5, (<-reply).alive)
+
+	sendKeys(key, "q")
+	assert.Len(t, <-finalAlive, 5)
+}
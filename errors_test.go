@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateParams(t *testing.T) {
+	valid := golParams{turns: 10, threads: 4, imageWidth: 16, imageHeight: 16}
+	require.NoError(t, validateParams(valid))
+
+	for name, change := range map[string]func(p *golParams){
+		"zero width":       func(p *golParams) { p.imageWidth = 0 },
+		"negative height":  func(p *golParams) { p.imageHeight = -16 },
+		"zero threads":     func(p *golParams) { p.threads = 0 },
+		"negative threads": func(p *golParams) { p.threads = -1 },
+		"too many threads": func(p *golParams) { p.threads = 17 },
+		"negative turns":   func(p *golParams) { p.turns = -1 },
+		"negative history": func(p *golParams) { p.history = -1 },
+		"negative cycles":  func(p *golParams) { p.cycleLimit = -1 },
+		"threshold":        func(p *golParams) { p.threshold = 256 },
+		"scale":            func(p *golParams) { p.scale = -2 },
+		"format":           func(p *golParams) { p.outputFormat = "bmp" },
+		"format extension": func(p *golParams) { p.output = "out/board.rle"; p.outputFormat = "png" },
+		"palette":          func(p *golParams) { p.palette = "rainbow" },
+		"output":           func(p *golParams) { p.output = "out/{nope}" },
+	} {
+		p := valid
+		change(&p)
+		assert.Error(t, validateParams(p), name)
+
+		// The game must not start, so this returns straight away
+		_, err := gameOfLife(p, nil)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestInputErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	corrupt := filepath.Join(dir, "corrupt.pgm")
+	require.NoError(t, ioutil.WriteFile(corrupt, []byte("P5\n16 16\n255\n\x00\x00"), 0644))
+	big := filepath.Join(dir, "big.rle")
+	require.NoError(t, ioutil.WriteFile(big, []byte("x = 20, y = 1\n20o!\n"), 0644))
+
+	for name, p := range map[string]golParams{
+		"missing":       {input: filepath.Join(dir, "missing.pgm")},
+		"size mismatch": {input: filepath.Join("images", "64x64.pgm")},
+		"corrupt":       {input: corrupt},
+		"too big":       {input: big},
+	} {
+		p.turns, p.threads, p.imageWidth, p.imageHeight = 1, 2, 16, 16
+		alive, err := gameOfLife(p, nil)
+		assert.Error(t, err, name)
+		assert.Nil(t, alive, name)
+	}
+}
+
+// TestInputErrorClosesEvents checks that event consumers still find out that the game is over.
+func TestInputErrorClosesEvents(t *testing.T) {
+	events := make(chan Event, 10)
+	_, err := gameOfLifeWithEvents(golParams{threads: 2, imageWidth: 16, imageHeight: 16, pattern: "missing.rle"}, nil, events)
+	require.Error(t, err)
+	_, open := <-events
+	assert.False(t, open)
+
+	// Invalid params stop the game before it starts, which must close the chans too
+	events = make(chan Event, 10)
+	_, err = gameOfLifeWithEvents(golParams{threads: 0, imageWidth: 16, imageHeight: 16}, nil, events)
+	require.Error(t, err)
+	_, open = <-events
+	assert.False(t, open)
+
+	frames := make(chan frame, 1)
+	_, err = runGameOfLife(golParams{threads: 2, imageWidth: 16, imageHeight: 16}, externalChans{frames: frames, metrics: newGameMetrics(3)})
+	require.Error(t, err)
+	_, open = <-frames
+	assert.False(t, open)
+}
+
+func TestOutputErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 1, threads: 2, imageWidth: 16, imageHeight: 16}
+
+	bad := p
+	bad.output = blockedOutput(t, dir)
+	_, err := gameOfLife(bad, nil)
+	assert.Error(t, err, "image")
+
+	// The image can be written but not the gif
+	bad = p
+	bad.output = filepath.Join(dir, "board")
+	bad.gifEvery = 1
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "board.gif"), os.ModePerm))
+	_, err = gameOfLife(bad, nil)
+	assert.Error(t, err, "gif")
+
+	bad = p
+	bad.output = filepath.Join(dir, "board")
+	bad.videoOut = blockedOutput(t, dir)
+	_, err = gameOfLife(bad, nil)
+	assert.Error(t, err, "video")
+}
+
+// TestSaveError checks that a failed save while running stops the game with the error.
+func TestSaveError(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 1000000000, threads: 2, imageWidth: 16, imageHeight: 16, output: blockedOutput(t, dir)}
+
+	key := make(chan rune)
+	result := make(chan error)
+	go func() {
+		_, err := gameOfLife(p, key)
+		result <- err
+	}()
+	key <- 's'
+	assert.Error(t, <-result)
+}
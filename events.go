@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Event is sent by the distributor whenever something happens in the game.
+type Event interface {
+	fmt.Stringer
+
+	// GetCompletedTurns returns the number of turns that had been completed when the event happened.
+	GetCompletedTurns() int
+}
+
+// AliveCellsCount is sent every 2 seconds with the number of alive cells.
+type AliveCellsCount struct {
+	CompletedTurns int
+	CellsCount     int
+}
+
+// TurnComplete is sent after every turn.
+type TurnComplete struct {
+	CompletedTurns int
+}
+
+// CellFlipped is sent for every cell that changed state during a turn.
+// It is also sent for every initially alive cell before the first turn.
+type CellFlipped struct {
+	CompletedTurns int
+	Cell           cell
+}
+
+// StateChange is sent whenever the game is paused, continued or stopped.
+type StateChange struct {
+	CompletedTurns int
+	NewState       progState
+}
+
+// FinalTurnComplete is sent once the game has ended, with the cells that are alive in the final world.
+type FinalTurnComplete struct {
+	CompletedTurns int
+	Alive          []cell
+}
+
+// ImageOutputComplete is sent once an image has been fully written by the io goroutine.
+type ImageOutputComplete struct {
+	CompletedTurns int
+	Filename       string // Path the image was written to, or - for stdout
+}
+
+// CycleDetected is sent the first time the world after a turn is the same as it was at most -cycles turns before,
+// after which it repeats forever.
+type CycleDetected struct {
+	CompletedTurns int
+	Start          int // Turn the repeated world was first seen
+	Period         int // Turns between repeats, 1 for a still life
+}
+
+func (e AliveCellsCount) GetCompletedTurns() int     { return e.CompletedTurns }
+func (e TurnComplete) GetCompletedTurns() int        { return e.CompletedTurns }
+func (e CellFlipped) GetCompletedTurns() int         { return e.CompletedTurns }
+func (e StateChange) GetCompletedTurns() int         { return e.CompletedTurns }
+func (e FinalTurnComplete) GetCompletedTurns() int   { return e.CompletedTurns }
+func (e ImageOutputComplete) GetCompletedTurns() int { return e.CompletedTurns }
+func (e CycleDetected) GetCompletedTurns() int       { return e.CompletedTurns }
+
+func (e AliveCellsCount) String() string {
+	return fmt.Sprintf("Turn %d: %d alive cells", e.CompletedTurns, e.CellsCount)
+}
+
+func (e TurnComplete) String() string {
+	return fmt.Sprintf("Turn %d complete", e.CompletedTurns)
+}
+
+func (e CellFlipped) String() string {
+	return fmt.Sprintf("Turn %d: cell (%d, %d) flipped", e.CompletedTurns, e.Cell.x, e.Cell.y)
+}
+
+func (e StateChange) String() string {
+	return fmt.Sprintf("Turn %d: %s", e.CompletedTurns, e.NewState)
+}
+
+func (e FinalTurnComplete) String() string {
+	return fmt.Sprintf("Turn %d: game over with %d alive cells", e.CompletedTurns, len(e.Alive))
+}
+
+func (e ImageOutputComplete) String() string {
+	return fmt.Sprintf("Turn %d: wrote %s", e.CompletedTurns, e.Filename)
+}
+
+func (e CycleDetected) String() string {
+	return fmt.Sprintf("Turn %d: %v", e.CompletedTurns, cycle{start: e.Start, period: e.Period})
+}
+
+// eventSubscriber receives events from an eventBroker.
+// Events that arrive while its buffer is full are dropped and counted instead of blocking the broker.
+type eventSubscriber struct {
+	events  chan Event
+	accept  func(Event) bool // nil accepts every event
+	dropped uint64
+}
+
+// takeDropped returns the number of events dropped since it was last called.
+func (s *eventSubscriber) takeDropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
+
+// eventBroker fans events out from the distributor to any number of subscribers.
+// It never waits for a subscriber, so slow clients cannot stall the distributor or the workers.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// run publishes every event received on events until it is closed, then closes all subscribers.
+func (b *eventBroker) run(events <-chan Event) {
+	for e := range events {
+		b.publish(e)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		close(s.events)
+		delete(b.subscribers, s)
+	}
+}
+
+func (b *eventBroker) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		if s.accept != nil && !s.accept(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// subscribe returns a new subscriber buffering up to buffer of the events that accept returns true for.
+// If the broker has already finished the subscriber's chan is closed straight away.
+func (b *eventBroker) subscribe(buffer int, accept func(Event) bool) *eventSubscriber {
+	s := &eventSubscriber{events: make(chan Event, buffer), accept: accept}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.events)
+	} else {
+		b.subscribers[s] = struct{}{}
+	}
+	return s
+}
+
+// listening reports whether anyone is subscribed.
+func (b *eventBroker) listening() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers) > 0
+}
+
+func (b *eventBroker) unsubscribe(s *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		close(s.events)
+		delete(b.subscribers, s)
+	}
+}
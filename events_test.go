@@ -0,0 +1,205 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBroker(t *testing.T) {
+	broker := newEventBroker()
+	events := make(chan Event)
+	finished := make(chan struct{})
+	go func() {
+		broker.run(events)
+		close(finished)
+	}()
+
+	assert.False(t, broker.listening())
+	all := broker.subscribe(2, nil)
+	assert.True(t, broker.listening())
+	turns := broker.subscribe(10, func(e Event) bool {
+		_, ok := e.(TurnComplete)
+		return ok
+	})
+
+	// Nobody reads from the subscribers, so this must not block once their buffers are full
+	for i := 1; i <= 5; i++ {
+		events <- TurnComplete{CompletedTurns: i}
+		events <- AliveCellsCount{CompletedTurns: i, CellsCount: 5}
+	}
+	close(events)
+	<-finished
+
+	var received []Event
+	for e := range all.events {
+		received = append(received, e)
+	}
+	assert.Equal(t, []Event{TurnComplete{1}, AliveCellsCount{1, 5}}, received)
+	assert.Equal(t, uint64(8), all.takeDropped())
+	assert.Equal(t, uint64(0), all.takeDropped())
+
+	received = nil
+	for e := range turns.events {
+		received = append(received, e)
+	}
+	assert.Len(t, received, 5)
+	assert.Equal(t, uint64(0), turns.takeDropped())
+
+	_, ok := <-broker.subscribe(1, nil).events
+	assert.False(t, ok, "subscribing after the game has ended should return a closed subscriber")
+}
+
+// collectEvents runs the game and returns every event sent apart from AliveCellsCount, which depends on timing.
+func collectEvents(t *testing.T, p golParams) ([]Event, []cell) {
+	events := make(chan Event)
+	received := make(chan []Event, 1)
+	go func() {
+		var all []Event
+		for e := range events {
+			if _, ok := e.(AliveCellsCount); !ok {
+				all = append(all, e)
+			}
+		}
+		received <- all
+	}()
+	alive, err := gameOfLifeWithEvents(p, nil, events)
+	require.NoError(t, err)
+	return <-received, alive
+}
+
+func TestEventSequence(t *testing.T) {
+	initial := []cell{{x: 4, y: 5}, {x: 5, y: 6}, {x: 3, y: 7}, {x: 4, y: 7}, {x: 5, y: 7}}
+	afterOne := []cell{{x: 3, y: 6}, {x: 5, y: 6}, {x: 4, y: 7}, {x: 5, y: 7}, {x: 4, y: 8}}
+
+	// Written to a temporary directory so as not to replace the reference images in out/
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	output := filepath.Join(dir, "{width}x{height}-{turns}")
+
+	for _, threads := range []int{1, 2, 4, 8} {
+		p := golParams{turns: 0, threads: threads, imageWidth: 16, imageHeight: 16, output: output}
+		events, _ := collectEvents(t, p)
+		var expected []Event
+		for _, c := range initial {
+			expected = append(expected, CellFlipped{0, c})
+		}
+		expected = append(expected,
+			FinalTurnComplete{0, initial},
+			ImageOutputComplete{0, filepath.Join(dir, "16x16-0.pgm")},
+			StateChange{0, STOP},
+		)
+		assert.Equal(t, expected, events, "16x16x%d-0", threads)
+
+		p.turns = 1
+		events, _ = collectEvents(t, p)
+		expected = nil
+		for _, c := range initial {
+			expected = append(expected, CellFlipped{0, c})
+		}
+		for _, c := range []cell{{x: 4, y: 5}, {x: 3, y: 6}, {x: 3, y: 7}, {x: 4, y: 8}} {
+			expected = append(expected, CellFlipped{1, c})
+		}
+		expected = append(expected,
+			TurnComplete{1},
+			FinalTurnComplete{1, afterOne},
+			ImageOutputComplete{1, filepath.Join(dir, "16x16-1.pgm")},
+			StateChange{1, STOP},
+		)
+		assert.Equal(t, expected, events, "16x16x%d-1", threads)
+	}
+}
+
+// TestEventFlipsReplay checks that replaying CellFlipped events reproduces the final board.
+func TestEventFlipsReplay(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 100, threads: 4, imageWidth: 16, imageHeight: 16, output: filepath.Join(dir, "board")}
+	events, finalAlive := collectEvents(t, p)
+
+	board := make(map[cell]bool)
+	turn := 0
+	for _, e := range events {
+		switch e := e.(type) {
+		case CellFlipped:
+			// Flips are sent before the TurnComplete of the turn they happened in
+			if e.CompletedTurns != 0 {
+				assert.Equal(t, turn+1, e.CompletedTurns)
+			}
+			board[e.Cell] = !board[e.Cell]
+		case TurnComplete:
+			turn++
+			assert.Equal(t, turn, e.CompletedTurns)
+		case FinalTurnComplete:
+			assert.Equal(t, p.turns, e.CompletedTurns)
+			assert.ElementsMatch(t, finalAlive, e.Alive)
+		}
+	}
+	assert.Equal(t, p.turns, turn)
+
+	var replayed []cell
+	for c, alive := range board {
+		if alive {
+			replayed = append(replayed, c)
+		}
+	}
+	assert.ElementsMatch(t, finalAlive, replayed)
+}
+
+// TestEventsOnlyWhileListening checks that flipped cells are only reported while someone is listening,
+// and that the flips are right once they start again.
+func TestEventsOnlyWhileListening(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 100, threads: 4, imageWidth: 16, imageHeight: 16, output: filepath.Join(dir, "board")}
+
+	// Nobody listens for the first 50 turns
+	steps := 0
+	listening := func() bool {
+		steps++
+		return steps > 50
+	}
+	events := make(chan Event)
+	received := make(chan []Event)
+	go func() {
+		var all []Event
+		for e := range events {
+			all = append(all, e)
+		}
+		received <- all
+	}()
+	finalAlive, err := runGameOfLife(p, externalChans{events: events, listening: listening})
+	require.NoError(t, err)
+
+	var initial []cell
+	flips := map[int][]cell{}
+	firstTurn := 0
+	for _, e := range <-received {
+		switch e := e.(type) {
+		case CellFlipped:
+			if e.CompletedTurns == 0 {
+				initial = append(initial, e.Cell)
+			} else {
+				flips[e.CompletedTurns] = append(flips[e.CompletedTurns], e.Cell)
+			}
+		case TurnComplete:
+			if firstTurn == 0 {
+				firstTurn = e.CompletedTurns
+			}
+		}
+	}
+	assert.Equal(t, 51, firstTurn)
+
+	world := testWorld(16, 16, initial...)
+	for turn := 0; turn < 50; turn++ {
+		world = referenceStep(world, 16, 16)
+	}
+	for turn := 51; turn <= 100; turn++ {
+		for _, c := range flips[turn] {
+			world[c.y][c.x] ^= 0xFF
+		}
+	}
+	assert.ElementsMatch(t, finalAlive, aliveCells(world))
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// conwayRule is the only rule the workers know how to run.
+const conwayRule = "B3/S23"
+
+// lifePattern is a pattern read from one of the Life pattern formats.
+type lifePattern struct {
+	width, height int
+	rule          string
+	comments      []string // Comment lines, without the comment marker
+	alive         []cell
+
+	// relative patterns have cells positioned relative to the middle of the board and no meaningful size,
+	// as in the Life 1.0x formats. Other patterns fit in a width x height box that is centred on the board.
+	relative bool
+
+	// tree holds macrocell patterns, which are drawn straight from the quadtree instead of listing alive cells.
+	tree *macrocell
+}
+
+// normaliseRule converts rules written as S/B, e.g. 23/3, to the B/S form.
+func normaliseRule(rule string) string {
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	if rule == "" {
+		return conwayRule
+	}
+	if !strings.HasPrefix(rule, "B") {
+		parts := strings.Split(rule, "/")
+		if len(parts) == 2 {
+			return "B" + strings.TrimPrefix(parts[1], "B") + "/S" + strings.TrimPrefix(parts[0], "S")
+		}
+	}
+	return rule
+}
+
+// emptyWorld returns a world of the size given by p with every cell dead.
+func emptyWorld(p golParams) [][]byte {
+	world := make([][]byte, p.imageHeight)
+	for y := range world {
+		world[y] = make([]byte, p.imageWidth)
+	}
+	return world
+}
+
+// centrePattern places the alive cells of a width x height pattern in the middle of an empty world.
+func centrePattern(p golParams, width, height int, alive []cell) ([][]byte, error) {
+	if width > p.imageWidth || height > p.imageHeight {
+		return nil, fmt.Errorf("%dx%d pattern does not fit on a %dx%d board", width, height, p.imageWidth, p.imageHeight)
+	}
+	world := emptyWorld(p)
+	offsetX := (p.imageWidth - width) / 2
+	offsetY := (p.imageHeight - height) / 2
+	for _, c := range alive {
+		world[c.y+offsetY][c.x+offsetX] = 0xFF
+	}
+	return world, nil
+}
+
+// placePattern builds a world of the size given by p containing pat.
+func placePattern(p golParams, pat lifePattern) ([][]byte, error) {
+	if pat.tree != nil {
+		return placeMacrocell(p, pat.tree)
+	}
+	if !pat.relative {
+		return centrePattern(p, pat.width, pat.height, pat.alive)
+	}
+	world := emptyWorld(p)
+	for _, c := range pat.alive {
+		x, y := c.x+p.imageWidth/2, c.y+p.imageHeight/2
+		if x < 0 || y < 0 || x >= p.imageWidth || y >= p.imageHeight {
+			return nil, fmt.Errorf("cell (%d, %d) of the pattern does not fit on a %dx%d board", c.x, c.y, p.imageWidth, p.imageHeight)
+		}
+		world[y][x] = 0xFF
+	}
+	return world, nil
+}
+
+// relativeCells returns the alive cells of world relative to the middle of the board, as used by placePattern.
+func relativeCells(width, height int, world [][]byte) []cell {
+	var alive []cell
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if world[y][x] != 0 {
+				alive = append(alive, cell{x: x - width/2, y: y - height/2})
+			}
+		}
+	}
+	return alive
+}
+
+// patternParsers read each of the pattern formats, by the names returned by detectFormat.
+var patternParsers = map[string]func(io.Reader) (lifePattern, error){
+	"rle":     parseRle,
+	"cells":   parseCells,
+	"life105": parseLife105,
+	"life106": parseLife106,
+	"mc":      parseMacrocell,
+}
+
+// imageFormat describes how to write one of the output formats.
+type imageFormat struct {
+	ext    string
+	encode func(w io.Writer, width, height int, world [][]byte, comments ...string) error
+}
+
+// outputFormats are the formats that output images can be written in, chosen by p.outputFormat.
+var outputFormats = map[string]imageFormat{
+	"pgm": {".pgm", func(w io.Writer, width, height int, world [][]byte, _ ...string) error {
+		return encodePgm(w, width, height, world)
+	}},
+	"rle":     {".rle", encodeRle},
+	"cells":   {".cells", encodeCells},
+	"life105": {".lif", encodeLife105},
+	"life106": {".lif", encodeLife106},
+	"mc":      {".mc", encodeMacrocell},
+	"png":     {".png", imageStyle{scale: 1, palette: palettes["mono"]}.encodePng},
+}
+
+// extensionFormats are the output formats chosen by the extension of the output template when p.outputFormat is empty.
+var extensionFormats = map[string]string{
+	".pgm":   "pgm",
+	".rle":   "rle",
+	".cells": "cells",
+	".lif":   "life106",
+	".life":  "life106",
+	".mc":    "mc",
+	".png":   "png",
+}
+
+// outputFormatName returns the name of the format output images are written in: p.outputFormat if it is set,
+// otherwise the one given by the extension of p.output, falling back to pgm.
+func outputFormatName(p golParams) string {
+	if p.outputFormat != "" {
+		return p.outputFormat
+	}
+	if name, ok := extensionFormats[strings.ToLower(filepath.Ext(p.output))]; ok {
+		return name
+	}
+	return "pgm"
+}
+
+// checkOutputFormat reports an output template whose extension belongs to a different format from p.outputFormat,
+// which would otherwise be written with the wrong contents for its name.
+func checkOutputFormat(p golParams) error {
+	ext := strings.ToLower(filepath.Ext(p.output))
+	name, ok := extensionFormats[ext]
+	if p.outputFormat == "" || !ok {
+		return nil
+	}
+	if outputFormats[p.outputFormat].ext != outputFormats[name].ext {
+		return fmt.Errorf("output %q has a %s extension but the output format is %s", p.output, ext, p.outputFormat)
+	}
+	return nil
+}
+
+// formatFor returns the format that output images are written in, with pictures drawn in the style set in p.
+func formatFor(p golParams) imageFormat {
+	name := outputFormatName(p)
+	if name == "png" {
+		return imageFormat{".png", styleFor(p).encodePng}
+	}
+	format, ok := outputFormats[name]
+	if !ok {
+		format = outputFormats["pgm"]
+	}
+	return format
+}
+
+var rleHeader = regexp.MustCompile(`(?m)^\s*x\s*=`)
+
+// detectFormat works out which format a file is in from its extension, falling back to its contents.
+// It returns "pgm" if nothing else matches.
+func detectFormat(filename string, data []byte) string {
+	header := bytes.TrimLeft(data, " \t\r\n")
+	life := func() string {
+		if bytes.HasPrefix(header, []byte("#Life 1.05")) {
+			return "life105"
+		}
+		return "life106"
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pgm", ".pbm", ".pnm":
+		return "pgm"
+	case ".rle":
+		return "rle"
+	case ".cells":
+		return "cells"
+	case ".lif", ".life":
+		return life()
+	case ".mc":
+		return "mc"
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("[M2]")):
+		return "mc"
+	case bytes.HasPrefix(header, []byte("#Life 1.0")):
+		return life()
+	case len(header) > 1 && header[0] == 'P' && header[1] >= '1' && header[1] <= '6':
+		return "pgm"
+	case rleHeader.Match(header):
+		return "rle"
+	case bytes.HasPrefix(header, []byte("!")) || len(bytes.Trim(header, ".O*\r\n")) == 0:
+		return "cells"
+	}
+	return "pgm"
+}
+
+// readPatternImage parses a pattern file and returns it placed on the board.
+func readPatternImage(p golParams, filename string, data []byte, format string) ([][]byte, error) {
+	pat, err := patternParsers[format](bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if pat.rule != conwayRule {
+		fmt.Fprintln(p.messages(), "Warning:", filename, "is for rule", pat.rule, "but it will be run with", conwayRule)
+	}
+
+	world, err := placePattern(p, pat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return world, nil
+}
+
+// writeImage receives an array of bytes and writes it to path, in the format given by outputFormatName.
+func writeImage(p golParams, i ioChans, path string) error {
+	format := formatFor(p)
+	world := receiveImage(p, i)
+
+	file, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	err = format.encode(file, p.imageWidth, p.imageHeight, world, filepath.Base(path))
+	if f, ok := file.(*os.File); ok && err == nil {
+		err = f.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.messages(), "File", path, "output done!")
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     string
+		format   string
+	}{
+		{"16x16.pgm", "P5\n16 16\n255\n", "pgm"},
+		{"glider.rle", "x = 3, y = 3\nbo$2bo$3o!", "rle"},
+		{"glider.cells", "!Name: Glider\n.O.\n", "cells"},
+		{"glider.lif", "#Life 1.05\n#P 0 0\n.*.\n", "life105"},
+		{"glider.LIF", "#Life 1.06\n0 0\n", "life106"},
+		{"glider.life", "0 0\n", "life106"},
+		{"glider", "#Life 1.05\n", "life105"},
+		{"glider", "#Life 1.06\n", "life106"},
+		{"glider", "  P5\n16 16\n255\n", "pgm"},
+		{"glider", "#N Glider\nx = 3, y = 3\n3o!", "rle"},
+		{"glider", "!Glider\n.O.\n", "cells"},
+		{"glider", ".O.\n..O\nOOO\n", "cells"},
+		{"gun.mc", "[M2] (golly 2.0)\n", "mc"},
+		{"gun", "[M2] (golly 2.0)\n", "mc"},
+		{"glider", "something else", "pgm"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.format, detectFormat(test.filename, []byte(test.data)), test.filename+": "+test.data)
+	}
+}
+
+func TestParseCells(t *testing.T) {
+	pat, err := parseCells(strings.NewReader("!Name: Glider\n!\n.O\n..O\r\n\nO*O\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Name: Glider", ""}, pat.comments)
+	assert.Equal(t, 3, pat.width)
+	assert.Equal(t, 4, pat.height)
+	assert.Equal(t, []cell{{1, 0}, {2, 1}, {0, 3}, {1, 3}, {2, 3}}, pat.alive)
+	assert.False(t, pat.relative)
+
+	_, err = parseCells(strings.NewReader(".O.\n.X.\n"))
+	assert.Error(t, err)
+}
+
+func TestParseLife106(t *testing.T) {
+	pat, err := parseLife106(strings.NewReader("#Life 1.06\n#D Glider\n0 -1\n1 0\n-1 1\n0 1\n1 1\n"))
+	require.NoError(t, err)
+	assert.True(t, pat.relative)
+	assert.Equal(t, []string{"Glider"}, pat.comments)
+	assert.Equal(t, []cell{{0, -1}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}, pat.alive)
+	assert.Equal(t, 3, pat.width)
+	assert.Equal(t, 3, pat.height)
+
+	for _, bad := range []string{"", "0 0\n", "#Life 1.06\n0\n", "#Life 1.06\na b\n"} {
+		_, err = parseLife106(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseLife105(t *testing.T) {
+	pat, err := parseLife105(strings.NewReader(`#Life 1.05
+#D Two blocks
+#R 23/36
+#P -1 -1
+.*
+..*
+***
+#P 5 5
+**
+`))
+	require.NoError(t, err)
+	assert.True(t, pat.relative)
+	assert.Equal(t, "B36/S23", pat.rule)
+	assert.Equal(t, []string{"Two blocks"}, pat.comments)
+	assert.Equal(t, []cell{{0, -1}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}, {5, 5}, {6, 5}}, pat.alive)
+	assert.Equal(t, 8, pat.width)
+	assert.Equal(t, 7, pat.height)
+
+	for _, bad := range []string{"", "#Life 1.06\n", "#Life 1.05\n#P 1\n", "#Life 1.05\n.x.\n"} {
+		_, err = parseLife105(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPlaceRelativePattern(t *testing.T) {
+	p := golParams{imageWidth: 8, imageHeight: 6}
+	world, err := placePattern(p, lifePattern{relative: true, alive: []cell{{0, 0}, {-4, -3}, {3, 2}}})
+	require.NoError(t, err)
+	assert.Equal(t, testWorld(8, 6, cell{4, 3}, cell{0, 0}, cell{7, 5}), world)
+
+	_, err = placePattern(p, lifePattern{relative: true, alive: []cell{{4, 0}}})
+	assert.Error(t, err)
+}
+
+// TestFormatRoundTrips writes boards in every output format and checks that reading them back gives the same board.
+func TestFormatRoundTrips(t *testing.T) {
+	boards := map[string]golParams{
+		"square": {imageWidth: 16, imageHeight: 16},
+		"wide":   {imageWidth: 17, imageHeight: 5},
+		"tall":   {imageWidth: 3, imageHeight: 11},
+	}
+	for name, p := range boards {
+		world := emptyWorld(p)
+		for y := 0; y < p.imageHeight; y++ {
+			for x := 0; x < p.imageWidth; x++ {
+				if (x*7+y*3)%5 == 0 {
+					world[y][x] = 0xFF
+				}
+			}
+		}
+		// Include the corners, which are the easiest to get wrong
+		world[0][0] = 0xFF
+		world[p.imageHeight-1][p.imageWidth-1] = 0xFF
+
+		for format, writer := range outputFormats {
+			if _, ok := patternParsers[format]; !ok {
+				continue
+			}
+			var buf bytes.Buffer
+			require.NoError(t, writer.encode(&buf, p.imageWidth, p.imageHeight, world, "round trip"))
+			assert.Equal(t, format, detectFormat("board"+writer.ext, buf.Bytes()), "%s %s", name, format)
+
+			pat, err := patternParsers[format](bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err, "%s %s", name, format)
+			assert.Equal(t, conwayRule, pat.rule)
+			decoded, err := placePattern(p, pat)
+			require.NoError(t, err, "%s %s", name, format)
+			assert.Equal(t, world, decoded, "%s %s:\n%s", name, format, buf.String())
+		}
+	}
+}
+
+func TestFormatEmptyBoard(t *testing.T) {
+	p := golParams{imageWidth: 4, imageHeight: 4}
+	for format, writer := range outputFormats {
+		if _, ok := patternParsers[format]; !ok {
+			continue
+		}
+		var buf bytes.Buffer
+		require.NoError(t, writer.encode(&buf, 4, 4, emptyWorld(p)))
+		pat, err := patternParsers[format](bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err, format)
+		assert.Empty(t, pat.alive, format)
+	}
+}
@@ -3,20 +3,33 @@ package main
 import (
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 )
 
-func worker(in inChans, out outChans, wChan chan byte, height int, width int, coms chan workerComs) {
+func worker(in inChans, out outChans, wChan chan byte, height int, width int, coms chan workerComs, m *workerMetrics, tr *workerTrace, z *workerHash, snap chan<- [][]byte) {
 	// World slice for the worker INCLUDING HALOS
 	world := make([][]byte, height)
 	for i := range world {
 		world[i] = make([]byte, width)
 	}
 
+	// Turns are only timed if something records the times
+	timed := m != nil || tr != nil
+	var span turnSpan
+	if timed {
+		span.waiting = time.Now()
+	}
+
+	// Hash of the worker's rows, kept up to date with the cells each turn flips if cycles are being looked for
+	var hash uint64
+
 	for {
 		select {
-		case command := <-coms: //Assign new command if available
+		case command, ok := <-coms: //Assign new command if available
+			if !ok {
+				// The game is over
+				return
+			}
 			switch command {
 			case INPUT:
 				for y := 1; y < height-1; y++ {
@@ -24,20 +37,48 @@ func worker(in inChans, out outChans, wChan chan byte, height int, width int, co
 						world[y][x] = <-wChan
 					}
 				}
+				if z != nil {
+					hash = worldHash(world[1:height-1], z.top, width)
+					z.hashes <- hash
+				}
 			case OUTPUT:
 				for y := 1; y < height-1; y++ {
 					for x := 0; x < width; x++ {
 						wChan <- world[y][x]
 					}
 				}
+			case SNAPSHOT:
+				// A copy of the rows in one go, much cheaper than OUTPUT for a frame that is only looked at
+				rows := make([][]byte, height-2)
+				for y := range rows {
+					rows[y] = append([]byte(nil), world[y+1]...)
+				}
+				snap <- rows
 			case WORK:
+				if timed {
+					span.started = time.Now()
+				}
 				for x := 0; x < width; x++ {
 					out.tChan <- world[1][x]
 					out.bChan <- world[height-2][x]
 					world[0][x] = <-in.tChan
 					world[height-1][x] = <-in.bChan
 				}
+				if timed {
+					span.exchanged = time.Now()
+				}
+				before := world
 				world = makeTurn(world, height, width)
+				if z != nil {
+					hash ^= flipsHash(before[1:height-1], world[1:height-1], z.top, width)
+					z.hashes <- hash
+				}
+				if timed {
+					span.done = time.Now()
+					m.record(span.exchanged.Sub(span.started), span.done.Sub(span.exchanged))
+					tr.record(span)
+					span.waiting = span.done
+				}
 			}
 		}
 	}
@@ -141,18 +182,20 @@ func receiveWorld(p golParams, workerChans [][]chan byte, world [][]byte, bounds
 	}
 }
 
-// Outputs current world as PGM
-func outputPgmImage(p golParams, d distributorChans, world [][]byte) {
+// Outputs the world after the given turn as an image and returns the path written to
+func outputPgmImage(p golParams, d distributorChans, world [][]byte, turn int) string {
 	//Request pgmIo goroutine to output 2D slice as image
-	fmt.Println("Output in progress...")
+	fmt.Fprintln(p.messages(), "Output in progress...")
 	d.io.command <- ioOutput
-	d.io.filename <- strconv.Itoa(p.imageHeight) + "x" + strconv.Itoa(p.imageWidth) + "-" + strconv.Itoa(p.turns)
+	filename := outputPath(p, turn, formatFor(p).ext)
+	d.io.filename <- filename
 
 	for y := 0; y < p.imageHeight; y++ {
 		for x := 0; x < p.imageWidth; x++ {
-			d.io.outputVal <- world[x][y] //Sends to channel for io to receive
+			d.io.outputVal <- world[y][x] //Sends to channel for io to receive
 		}
 	}
+	return filename
 }
 
 // Sends a given command to each worker
@@ -162,8 +205,391 @@ func sendCommand(p golParams, comChans []chan workerComs, command workerComs) {
 	}
 }
 
+// distributorState holds everything the distributor needs to act on key presses and control requests.
+type distributorState struct {
+	p           golParams
+	d           distributorChans
+	workerChans [][]chan byte
+	comChans    []chan workerComs
+	world       [][]byte
+	bounds      [][]int
+	turn        int
+	state       progState
+	previous    [][]byte       // World before the last turn, only kept while events are being sent or history recorded
+	stale       bool           // Whether turns have been computed since s.world was last fetched, although s.previous is kept
+	history     *worldHistory  // nil if p.history is 0
+	cycles      *cycleDetector // nil if p.cycleLimit is 0
+	edits       []int32        // Cells changed by the edit being made, for the history
+	view        view
+	editor      editor
+	redraw      bool   // Whether a key or control request has changed what the renderer shows since the last frame
+	speed       int    // Target turns per second, 0 if unlimited
+	throttle    ticker // Ticks at speed turns per second, nil if unlimited
+	runUntil    int    // Turn to pause at, 0 if none
+	count       int    // Number typed before a command, e.g. 10n
+	counting    bool   // Whether count has been typed
+	err         error  // First error from the io goroutine, which stops the game
+}
+
+// fail records err, if it is the first one, and stops the game
+func (s *distributorState) fail(err error) {
+	if err == nil {
+		return
+	}
+	if s.err == nil {
+		s.err = err
+	}
+	s.setState(STOP)
+}
+
+// takeCount returns and clears the number typed before a command, if there was one
+func (s *distributorState) takeCount() (int, bool) {
+	count, counting := s.count, s.counting
+	s.count, s.counting = 0, false
+	return count, counting
+}
+
+// render sends the current world to the renderer, unless it hasn't taken the last frame yet,
+// so that a slow terminal never holds up the workers and no frame is fetched only to be thrown away.
+func (s *distributorState) render() {
+	if s.d.frames == nil || len(s.d.frames) > 0 {
+		return
+	}
+	f := frame{
+		turn:     s.turn,
+		state:    s.state,
+		view:     s.view,
+		editor:   s.editor,
+		speed:    s.speed,
+		runUntil: s.runUntil,
+	}
+	if s.history != nil {
+		f.rewound = s.history.rewound
+	}
+	if s.counting {
+		f.count = strconv.Itoa(s.count)
+	}
+	if s.stale {
+		f.world = s.snapshot()
+	} else {
+		f.world = make([][]byte, s.p.imageHeight)
+		for y := range f.world {
+			f.world[y] = append([]byte(nil), s.world[y]...)
+		}
+	}
+	f.alive = len(findAlive(s.p, f.world))
+
+	s.d.frames <- f
+	s.redraw = false
+}
+
+// snapshot returns a copy of the current world made by the workers, which leaves s.world alone
+// and is much quicker than fetching the world a byte at a time.
+func (s *distributorState) snapshot() [][]byte {
+	s.command(SNAPSHOT)
+	start := s.d.metrics.now()
+	world := make([][]byte, 0, s.p.imageHeight)
+	for _, rows := range s.d.snapshots {
+		world = append(world, <-rows...)
+	}
+	s.d.metrics.addWorldBlocked(start)
+	return world
+}
+
+// emit sends an event if anyone is listening
+func (s *distributorState) emit(e Event) {
+	if s.d.events != nil {
+		s.d.events <- e
+	}
+}
+
+// emitFlips sends a CellFlipped event for every cell that differs between s.previous and s.world
+func (s *distributorState) emitFlips() {
+	for y := 0; y < s.p.imageHeight; y++ {
+		for x := 0; x < s.p.imageWidth; x++ {
+			if s.previous[y][x] != s.world[y][x] {
+				s.emit(CellFlipped{CompletedTurns: s.turn, Cell: cell{x: x, y: y}})
+			}
+		}
+	}
+}
+
+// command sends a command to every worker, which waits for any that are still busy
+func (s *distributorState) command(command workerComs) {
+	start := s.d.metrics.now()
+	sendCommand(s.p, s.comChans, command)
+	s.d.metrics.addCommandBlocked(start)
+}
+
+// fetchWorld copies the current world from the workers into s.world
+func (s *distributorState) fetchWorld() {
+	s.command(OUTPUT)
+	start := s.d.metrics.now()
+	receiveWorld(s.p, s.workerChans, s.world, s.bounds)
+	s.d.metrics.addWorldBlocked(start)
+	s.stale = false
+}
+
+// pushWorld sends s.world to the workers, replacing whatever they were holding
+func (s *distributorState) pushWorld() {
+	s.command(INPUT)
+	start := s.d.metrics.now()
+	sendWorld(s.p, s.workerChans, s.world, s.bounds)
+	s.d.metrics.addWorldBlocked(start)
+	s.stale = false
+	if s.cycles != nil {
+		// The world is a new one, which any earlier world repeating tells nothing about
+		s.cycles.reset()
+		s.cycles.checkpoint(s.turn, s.world)
+		s.cycles.add(s.turn, s.collectHash(), s.sameWorld)
+	}
+}
+
+// listening reports whether anyone is reading events, so that turns are only fetched to find flipped cells
+// while someone wants them.
+func (s *distributorState) listening() bool {
+	return s.d.events != nil && (s.d.listening == nil || s.d.listening())
+}
+
+// step makes the workers compute a single turn.
+// When events are being read or history recorded the new world is fetched so that flipped cells can be found.
+func (s *distributorState) step() {
+	listening := s.listening()
+	flips := s.previous != nil && (listening || s.history != nil)
+	if flips && s.stale {
+		// Flips are found from the world before the turn, which nobody has fetched since listening stopped
+		s.fetchWorld()
+	}
+	s.command(WORK)
+	s.turn++
+	s.d.metrics.setTurn(s.turn)
+	if !flips {
+		s.stale = true
+	} else {
+		s.world, s.previous = s.previous, s.world
+		s.fetchWorld()
+		if listening {
+			s.emitFlips()
+			s.emit(TurnComplete{CompletedTurns: s.turn})
+		}
+		if s.history != nil {
+			s.history.push(historyEntry{turnBefore: s.turn - 1, turnAfter: s.turn, flips: diffWorlds(s.p, s.previous, s.world)})
+		}
+	}
+	s.capture()
+	if s.cycles != nil {
+		s.checkCycle(s.collectHash())
+	}
+	if s.runUntil != 0 && s.turn >= s.runUntil {
+		s.runUntil = 0
+		s.setState(PAUSE)
+	}
+}
+
+// outputImage writes the current world to an image and waits for the io goroutine to finish
+func (s *distributorState) outputImage() error {
+	start := s.d.metrics.now()
+	s.fetchWorld()
+	filename := outputPgmImage(s.p, s.d, s.world, s.turn)
+	if err := <-s.d.io.err; err != nil {
+		return err
+	}
+	s.d.metrics.observeSnapshot(start)
+	s.emit(ImageOutputComplete{CompletedTurns: s.turn, Filename: filename})
+	return nil
+}
+
+// capture records the world in the gif and video stream on the turns they want it
+func (s *distributorState) capture() {
+	gif := s.p.gifEvery > 0 && s.turn%s.p.gifEvery == 0
+	video := s.d.video != nil && (s.p.videoEvery <= 1 || s.turn%s.p.videoEvery == 0)
+	if !gif && !video {
+		return
+	}
+	if s.previous == nil || s.stale {
+		s.fetchWorld()
+	}
+	if gif {
+		s.captureFrame()
+	}
+	if video {
+		s.d.video.send(s.world)
+	}
+}
+
+// captureFrame sends s.world to the io goroutine as the next frame of the gif
+func (s *distributorState) captureFrame() {
+	s.d.io.command <- ioFrame
+	for y := 0; y < s.p.imageHeight; y++ {
+		for x := 0; x < s.p.imageWidth; x++ {
+			s.d.io.outputVal <- s.world[y][x]
+		}
+	}
+}
+
+// outputAnimation writes the frames captured during the game to a gif and waits for the io goroutine to finish
+func (s *distributorState) outputAnimation() error {
+	s.d.io.command <- ioAnimation
+	s.d.io.filename <- animationPath(s.p, s.turn)
+	return <-s.d.io.err
+}
+
+// setState changes the program state and reports pausing and continuing to the user
+func (s *distributorState) setState(state progState) {
+	if state == s.state {
+		return
+	}
+	s.state = state
+	s.d.metrics.sampleRate(s.turn, false)
+	s.emit(StateChange{CompletedTurns: s.turn, NewState: state})
+	switch state {
+	case PAUSE:
+		fmt.Fprintln(s.p.messages(), "Waiting...")
+	case CONTINUE:
+		fmt.Fprintln(s.p.messages(), "Continuing...")
+	}
+}
+
+// handleKey applies a single key press
+func (s *distributorState) handleKey(r rune) {
+	if s.handleEditKey(r) {
+		s.redraw = true
+		return
+	}
+
+	switch r {
+	case keyUp:
+		s.view.pan(0, -panGlyphs, s.p.imageWidth, s.p.imageHeight)
+	case keyDown:
+		s.view.pan(0, panGlyphs, s.p.imageWidth, s.p.imageHeight)
+	case keyLeft:
+		s.view.pan(-panGlyphs, 0, s.p.imageWidth, s.p.imageHeight)
+	case keyRight:
+		s.view.pan(panGlyphs, 0, s.p.imageWidth, s.p.imageHeight)
+	case '+', '=':
+		if s.view.zoom > 0 {
+			s.view.zoom--
+		}
+	case '-':
+		if s.view.zoom < maxZoom {
+			s.view.zoom++
+		}
+	case 'g':
+		s.view.halfBlock = !s.view.halfBlock
+	}
+
+	if r >= '0' && r <= '9' {
+		s.count = s.count*10 + int(r-'0')
+		s.counting = true
+		s.redraw = true
+		return
+	}
+	count, counting := s.takeCount()
+
+	switch r {
+	case keyEsc:
+		// Cancels the count, which takeCount has already done
+	case 'n':
+		// Step one turn, or count turns, while paused
+		if !counting {
+			count = 1
+		}
+		for i := 0; i < count && s.state == PAUSE && s.turn < s.p.turns; i++ {
+			s.step()
+		}
+	case 'f':
+		if counting {
+			s.setSpeed(count)
+		} else {
+			s.faster()
+		}
+	case 'd':
+		s.slower()
+	case 'u':
+		if counting {
+			s.runUntilTurn(count)
+		}
+	case ',', '<':
+		if !counting {
+			count = 1
+		}
+		s.rewind(count)
+	case '.', '>':
+		if !counting {
+			count = 1
+		}
+		s.rewind(-count)
+	}
+
+	switch string(r) {
+	case "s":
+		s.fail(s.outputImage())
+	case "p":
+		if s.state == PAUSE {
+			s.setState(CONTINUE)
+		} else {
+			s.setState(PAUSE)
+		}
+	case "q":
+		s.setState(STOP)
+	}
+	s.redraw = true
+}
+
+// handleControl applies a request from the control chan and replies with the resulting game status
+func (s *distributorState) handleControl(req controlRequest) {
+	res := controlResponse{}
+	switch req.command {
+	case controlPause:
+		s.setState(PAUSE)
+	case controlResume:
+		s.setState(CONTINUE)
+	case controlStep:
+		s.setState(PAUSE)
+		for i := 0; i < req.n && s.turn < s.p.turns; i++ {
+			s.step()
+		}
+	case controlSpeed:
+		s.setSpeed(req.n)
+	case controlRunUntil:
+		s.runUntilTurn(req.n)
+	case controlQuit:
+		s.setState(STOP)
+	}
+
+	if req.command == controlStatus || req.command == controlSnapshot {
+		s.fetchWorld()
+		res.alive = len(findAlive(s.p, s.world))
+	}
+	if req.command == controlSnapshot {
+		res.world = make([][]byte, s.p.imageHeight)
+		for y := range res.world {
+			res.world[y] = append([]byte(nil), s.world[y]...)
+		}
+	}
+	res.turn = s.turn
+	res.state = s.state
+	res.speed = s.speed
+	res.runUntil = s.runUntil
+	req.reply <- res
+	s.redraw = true
+}
+
 // distributor divides the work between workers and interacts with other goroutines.
-func distributor(p golParams, d distributorChans, alive chan []cell, workerChans [][]chan byte, key chan rune, comChans []chan workerComs) {
+func distributor(p golParams, d distributorChans, result chan<- gameResult, workerChans [][]chan byte, key <-chan rune, comChans []chan workerComs) {
+	// Let the workers and the io goroutine return once the game is over
+	defer func() {
+		for _, c := range comChans {
+			close(c)
+		}
+		close(d.io.command)
+	}()
+	if d.events != nil {
+		defer close(d.events)
+	}
+	if d.frames != nil {
+		defer close(d.frames)
+	}
 
 	// Create the 2D slice to store the world.
 	world := make([][]byte, p.imageHeight)
@@ -173,79 +599,136 @@ func distributor(p golParams, d distributorChans, alive chan []cell, workerChans
 
 	// Request the io goroutine to read in the image with the given filename.
 	d.io.command <- ioInput
-	d.io.filename <- strings.Join([]string{strconv.Itoa(p.imageWidth), strconv.Itoa(p.imageHeight)}, "x")
+	d.io.filename <- inputPath(p)
+	if err := <-d.io.err; err != nil {
+		if d.video != nil {
+			_ = d.video.close()
+		}
+		result <- gameResult{err: err}
+		return
+	}
 	for y := 0; y < p.imageHeight; y++ {
 		for x := 0; x < p.imageWidth; x++ {
 			val := <-d.io.inputVal
 			if val != 0 {
-				fmt.Println("Alive cell at", x, y)
+				fmt.Fprintln(p.messages(), "Alive cell at", x, y)
 				world[y][x] = val
 			}
 		}
 	}
 
-	bounds := findBounds(p)
+	s := &distributorState{
+		p:           p,
+		d:           d,
+		workerChans: workerChans,
+		comChans:    comChans,
+		world:       world,
+		bounds:      findBounds(p),
+		state:       CONTINUE,
+		editor:      newEditor(),
+	}
+	if p.cycleLimit > 0 {
+		s.cycles = newCycleDetector(p.cycleLimit)
+	}
 
 	//Send initial world to workers
-	sendCommand(p, comChans, INPUT)
-	sendWorld(p, workerChans, world, bounds)
+	s.pushWorld()
+
+	if p.history > 0 {
+		s.history = newWorldHistory(p.history)
+	}
+	if d.events != nil || s.history != nil {
+		s.previous = make([][]byte, p.imageHeight)
+		for i := range s.previous {
+			s.previous[i] = make([]byte, p.imageWidth)
+		}
+	}
+	if d.events != nil {
+		s.emitFlips()
+	}
+	s.capture()
 
 	timer := time.NewTicker(2 * time.Second)
+	defer timer.Stop()
+
+	// Only fetch frames for the renderer if there is one
+	var frameTicks <-chan time.Time
+	if d.frames != nil {
+		frameTicker := time.NewTicker(100 * time.Millisecond)
+		defer frameTicker.Stop()
+		frameTicks = frameTicker.C
+		s.render()
+	}
+
+	for s.turn < p.turns && s.state != STOP {
+		if s.state == PAUSE {
+			// Nothing to compute, so block until we are told what to do
+			select {
+			case <-frameTicks:
+				// The world hasn't changed, so only draw it again if the view or status line has
+				if s.redraw {
+					s.render()
+				}
+			case r := <-key:
+				s.handleKey(r)
+			case req := <-d.control:
+				s.handleControl(req)
+			}
+			continue
+		}
 
-	state := CONTINUE
-	for turn := 0; (turn < p.turns) && (state == CONTINUE); {
 		select {
 		case <-timer.C:
-			sendCommand(p, comChans, OUTPUT)
-			receiveWorld(p, workerChans, world, bounds)
-			alive := findAlive(p, world)
-			fmt.Println("Alive cells: ", len(alive))
-		case runeInt := <-key:
-			rune := string(runeInt)
-			switch rune {
-			case "s":
-				sendCommand(p, comChans, OUTPUT)
-				receiveWorld(p, workerChans, world, bounds)
-				outputPgmImage(p, d, world)
-			case "p":
-				state = PAUSE
-				fmt.Println("Waiting...")
-				for state == PAUSE {
-					runeInt = <-key
-					rune = string(runeInt)
-					switch rune {
-					case "s":
-						sendCommand(p, comChans, OUTPUT)
-						receiveWorld(p, workerChans, world, bounds)
-						outputPgmImage(p, d, world)
-					case "q":
-						state = STOP
-					case "p":
-						state = CONTINUE
-						fmt.Println("Continuing...")
-					}
-				}
-			case "q":
-				state = STOP
+			s.fetchWorld()
+			alive := findAlive(p, s.world)
+			d.metrics.setAlive(len(alive))
+			d.metrics.sampleRate(s.turn, true)
+			if d.frames == nil {
+				// The renderer's status line already shows this
+				fmt.Fprintln(p.messages(), "Alive cells: ", len(alive))
 			}
-		default:
-			sendCommand(p, comChans, WORK)
-			turn++
+			s.emit(AliveCellsCount{CompletedTurns: s.turn, CellsCount: len(alive)})
+		case <-frameTicks:
+			s.render()
+		case r := <-key:
+			s.handleKey(r)
+		case req := <-d.control:
+			s.handleControl(req)
+		case <-s.turnTicks():
+			s.step()
 		}
 	}
+	s.setSpeed(0)
 
-	// Receive world after all turns have been completed
-	sendCommand(p, comChans, OUTPUT)
-	receiveWorld(p, workerChans, world, bounds)
-	outputPgmImage(p, d, world)
-
-	// Go through the world and append the cells that are still alive.
-	finalAlive := findAlive(p, world)
+	// Receive world after all turns have been completed and go through it to find the cells that are still alive.
+	s.fetchWorld()
+	finalAlive := findAlive(p, s.world)
+	d.metrics.setAlive(len(finalAlive))
+	s.emit(FinalTurnComplete{CompletedTurns: s.turn, Alive: finalAlive})
 
-	// Make sure that the Io has finished any output before exiting.
-	d.io.command <- ioCheckIdle
-	<-d.io.idle
+	// Output the final world and make sure that the Io has finished before exiting.
+	// Nothing more is written once something has gone wrong.
+	if s.err == nil {
+		s.fail(s.outputImage())
+	}
+	if s.err == nil && p.gifEvery > 0 {
+		s.fail(s.outputAnimation())
+	}
+	if s.err == nil && d.tracer != nil {
+		s.fail(d.tracer.writeTraceFile(expandOutput(p.traceOut, p, s.turn, time.Now()), p.messages()))
+	}
+	if s.err == nil && p.censusOut != "" {
+		s.fail(writeCensusFile(expandOutput(p.censusOut, p, s.turn, time.Now()), s.world, p.messages()))
+	}
+	if d.video != nil {
+		s.fail(d.video.close())
+	}
+	s.setState(STOP)
 
 	// Return the coordinates of cells that are still alive.
-	alive <- finalAlive
+	if s.err != nil {
+		result <- gameResult{err: s.err}
+		return
+	}
+	result <- gameResult{alive: finalAlive}
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var goldenBudget = flag.Int64("golden-budget", 5000000,
+	"Largest width*height*turns of the reference images in out/ that TestGolden runs, or 0 to run them all.")
+
+// goldenName matches reference images named WxH-turns.pgm, as written by the default output template.
+var goldenName = regexp.MustCompile(`^(\d+)x(\d+)-(\d+)\.pgm$`)
+
+// goldenSkips are reference images in out/ that aren't the board after the turns in their names, and why.
+var goldenSkips = map[string]string{
+	"512x512-10000000.pgm": "only the header was saved, with no cells",
+}
+
+// goldenThreads are the thread counts each reference image is checked with.
+var goldenThreads = []int{1, 3, 8}
+
+// goldenMismatchLimit is the most differing cells listed in a mismatch report.
+const goldenMismatchLimit = 10
+
+// golden is a reference image of the board after some number of turns.
+type golden struct {
+	path  string
+	p     golParams
+	world [][]byte
+	skip  string // Why the image can't be checked, if it can't
+}
+
+// cost is roughly how much work it takes to play the game up to the reference image.
+func (g golden) cost() int64 {
+	return int64(g.p.imageWidth) * int64(g.p.imageHeight) * int64(g.p.turns)
+}
+
+// findGoldens returns every reference image in dir, sorted by cost.
+func findGoldens(dir string) ([]golden, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var goldens []golden
+	for _, file := range files {
+		m := goldenName.FindStringSubmatch(file.Name())
+		if m == nil {
+			continue
+		}
+		g := golden{path: filepath.Join(dir, file.Name()), skip: goldenSkips[file.Name()]}
+		g.p.imageWidth, _ = strconv.Atoi(m[1])
+		g.p.imageHeight, _ = strconv.Atoi(m[2])
+		g.p.turns, _ = strconv.Atoi(m[3])
+		goldens = append(goldens, g)
+	}
+	sort.Slice(goldens, func(i, j int) bool {
+		return goldens[i].cost() < goldens[j].cost()
+	})
+	return goldens, nil
+}
+
+// load reads the reference image.
+func (g *golden) load() error {
+	data, err := ioutil.ReadFile(g.path)
+	if err != nil {
+		return err
+	}
+	h, world, err := parseNetpbm(bytes.NewReader(data), 0)
+	if err != nil {
+		return err
+	}
+	if h.width != g.p.imageWidth || h.height != g.p.imageHeight {
+		return fmt.Errorf("image is %dx%d but its name says %dx%d", h.width, h.height, g.p.imageWidth, g.p.imageHeight)
+	}
+	g.world = world
+	return nil
+}
+
+// replay plays the game up to the reference image with referenceStep, starting from the matching image in images/.
+// The references have to agree with it, so that none of them are just the engine's own output.
+func (g golden) replay() ([][]byte, error) {
+	world, err := readImage(g.p, filepath.Join("images", fmt.Sprintf("%dx%d.pgm", g.p.imageWidth, g.p.imageHeight)))
+	if err != nil {
+		return nil, err
+	}
+	for turn := 0; turn < g.p.turns; turn++ {
+		world = referenceStep(world, g.p.imageWidth, g.p.imageHeight)
+	}
+	return world, nil
+}
+
+// goldenMismatches describes every cell that differs between want and got, or returns "" if they match.
+func goldenMismatches(want, got [][]byte, width, height int) string {
+	var lines []string
+	missing, unexpected := 0, 0
+	minX, minY, maxX, maxY := width, height, -1, -1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			wantAlive, gotAlive := want[y][x] != 0, got[y][x] != 0
+			if wantAlive == gotAlive {
+				continue
+			}
+			if wantAlive {
+				missing++
+			} else {
+				unexpected++
+			}
+			if len(lines) < goldenMismatchLimit {
+				if wantAlive {
+					lines = append(lines, fmt.Sprintf("  (%d, %d): want alive, got dead", x, y))
+				} else {
+					lines = append(lines, fmt.Sprintf("  (%d, %d): want dead, got alive", x, y))
+				}
+			}
+			if x < minX {
+				minX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+	}
+	total := missing + unexpected
+	if total == 0 {
+		return ""
+	}
+	report := fmt.Sprintf("%d cells differ (%d missing, %d unexpected) between (%d, %d) and (%d, %d):\n",
+		total, missing, unexpected, minX, minY, maxX, maxY)
+	report += strings.Join(lines, "\n")
+	if total > len(lines) {
+		report += fmt.Sprintf("\n  ... and %d more", total-len(lines))
+	}
+	return report
+}
+
+func TestGoldenMismatches(t *testing.T) {
+	want := testWorld(4, 3, cell{0, 0}, cell{3, 2})
+	assert.Equal(t, "", goldenMismatches(want, want, 4, 3))
+
+	got := testWorld(4, 3, cell{0, 0}, cell{1, 1})
+	assert.Equal(t, "2 cells differ (1 missing, 1 unexpected) between (1, 1) and (3, 2):\n"+
+		"  (1, 1): want dead, got alive\n"+
+		"  (3, 2): want alive, got dead", goldenMismatches(want, got, 4, 3))
+
+	var alive []cell
+	for x := 0; x < 12; x++ {
+		alive = append(alive, cell{x, 0})
+	}
+	report := goldenMismatches(testWorld(12, 1), testWorld(12, 1, alive...), 12, 1)
+	assert.True(t, strings.HasSuffix(report, "  (9, 0): want dead, got alive\n  ... and 2 more"), report)
+}
+
+// TestGolden plays the game up to every reference image in out/ with several thread counts and compares the results,
+// after checking the image itself against referenceStep.
+// Images that would take too long to reach are skipped, and listed, unless -golden-budget is raised.
+func TestGolden(t *testing.T) {
+	goldens, err := findGoldens("out")
+	require.NoError(t, err)
+	require.NotEmpty(t, goldens)
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	var skipped []string
+	defer func() {
+		if len(skipped) > 0 {
+			t.Logf("skipped %d reference images costing more than -golden-budget %d: %s",
+				len(skipped), *goldenBudget, strings.Join(skipped, ", "))
+		}
+	}()
+
+	for _, g := range goldens {
+		g := g
+		name := strings.TrimSuffix(filepath.Base(g.path), ".pgm")
+		if g.skip == "" && *goldenBudget > 0 && g.cost() > *goldenBudget {
+			skipped = append(skipped, name)
+		}
+		t.Run(name, func(t *testing.T) {
+			if g.skip != "" {
+				t.Skip(g.skip)
+			}
+			if *goldenBudget > 0 && g.cost() > *goldenBudget {
+				t.Skipf("costs %d, more than -golden-budget", g.cost())
+			}
+			if err := g.load(); err != nil {
+				t.Fatalf("unreadable reference: %v", err)
+			}
+			want, err := g.replay()
+			require.NoError(t, err)
+			if report := goldenMismatches(want, g.world, g.p.imageWidth, g.p.imageHeight); report != "" {
+				t.Fatalf("reference disagrees with referenceStep: %s", report)
+			}
+			for _, threads := range goldenThreads {
+				if threads > g.p.imageHeight {
+					continue
+				}
+				p := g.p
+				p.threads = threads
+				p.output = filepath.Join(dir, "{width}x{height}-{turns}")
+				alive, err := gameOfLife(p, nil)
+				require.NoError(t, err)
+				got := testWorld(p.imageWidth, p.imageHeight, alive...)
+				if report := goldenMismatches(g.world, got, p.imageWidth, p.imageHeight); report != "" {
+					t.Errorf("%d threads: %s", threads, report)
+				}
+			}
+		})
+	}
+}
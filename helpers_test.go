@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tempDir makes a directory for a test and returns it along with a function that removes it.
+func tempDir(t testing.TB) (string, func()) {
+	dir, err := ioutil.TempDir("", "gol-test")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// startKeyTest runs the game p with ext in the background, driven by the returned key and control chans,
+// which replace any in ext. The final alive cells are sent once the game has finished.
+// Unless p.output is set the final image is written to a temporary directory, which is removed before then.
+func startKeyTest(t *testing.T, p golParams, ext externalChans) (chan rune, chan controlRequest, chan []cell) {
+	dir, cleanup := tempDir(t)
+	if p.output == "" {
+		p.output = filepath.Join(dir, "board")
+	}
+	key := make(chan rune)
+	control := make(chan controlRequest)
+	finalAlive := make(chan []cell)
+	ext.key = key
+	ext.control = control
+	go func() {
+		alive, err := runGameOfLife(p, ext)
+		assert.NoError(t, err)
+		cleanup()
+		finalAlive <- alive
+	}()
+	return key, control, finalAlive
+}
+
+// sendKeys presses each key in turn.
+func sendKeys(key chan<- rune, keys string) {
+	for _, r := range keys {
+		key <- r
+	}
+}
+
+// blockedOutput returns an output template that can't be written because its directory is a file.
+func blockedOutput(t testing.TB, dir string) string {
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	return filepath.Join(file, "board")
+}
+
+// testWorld returns a width x height world with the given cells alive.
+func testWorld(width, height int, alive ...cell) [][]byte {
+	world := make([][]byte, height)
+	for y := range world {
+		world[y] = make([]byte, width)
+	}
+	for _, c := range alive {
+		world[c.y][c.x] = 0xFF
+	}
+	return world
+}
+
+// aliveCells returns the alive cells of a world in row-major order.
+func aliveCells(world [][]byte) []cell {
+	var alive []cell
+	for y := range world {
+		for x := range world[y] {
+			if world[y][x] != 0 {
+				alive = append(alive, cell{x: x, y: y})
+			}
+		}
+	}
+	return alive
+}
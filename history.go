@@ -0,0 +1,115 @@
+package main
+
+// historyEntry is the change from one world to the next, stored as the indices (y*width + x) of the cells that flipped.
+// Flipping the same cells again undoes the change, so one entry is enough to step either way.
+type historyEntry struct {
+	turnBefore int
+	turnAfter  int // Same as turnBefore for edits made while paused
+	flips      []int32
+}
+
+// worldHistory is a bounded ring buffer of the most recent changes to the world.
+// Only the current world is stored in full; older ones are rebuilt by undoing entries from the newest back.
+type worldHistory struct {
+	entries []historyEntry
+	start   int // Index of the oldest entry
+	length  int
+	rewound int // Number of the newest entries that have been undone
+}
+
+func newWorldHistory(size int) *worldHistory {
+	return &worldHistory{entries: make([]historyEntry, size)}
+}
+
+// at returns the i-th oldest entry.
+func (h *worldHistory) at(i int) *historyEntry {
+	return &h.entries[(h.start+i)%len(h.entries)]
+}
+
+// push records a new change, dropping any undone entries and then the oldest entry if the buffer is full.
+func (h *worldHistory) push(e historyEntry) {
+	if len(h.entries) == 0 {
+		return
+	}
+	h.length -= h.rewound
+	h.rewound = 0
+	if h.length == len(h.entries) {
+		h.start = (h.start + 1) % len(h.entries)
+		h.length--
+	}
+	*h.at(h.length) = e
+	h.length++
+}
+
+// back returns the newest entry that hasn't been undone and marks it as undone.
+func (h *worldHistory) back() (historyEntry, bool) {
+	if h.rewound == h.length {
+		return historyEntry{}, false
+	}
+	h.rewound++
+	return *h.at(h.length - h.rewound), true
+}
+
+// forward returns the oldest undone entry and marks it as redone.
+func (h *worldHistory) forward() (historyEntry, bool) {
+	if h.rewound == 0 {
+		return historyEntry{}, false
+	}
+	e := *h.at(h.length - h.rewound)
+	h.rewound--
+	return e, true
+}
+
+// diffWorlds returns the indices of the cells that differ between two worlds.
+func diffWorlds(p golParams, before, after [][]byte) []int32 {
+	var flips []int32
+	for y := 0; y < p.imageHeight; y++ {
+		for x := 0; x < p.imageWidth; x++ {
+			if (before[y][x] != 0) != (after[y][x] != 0) {
+				flips = append(flips, int32(y*p.imageWidth+x))
+			}
+		}
+	}
+	return flips
+}
+
+// applyFlips flips the given cells of s.world and reports each one as an event.
+func (s *distributorState) applyFlips(flips []int32) {
+	for _, i := range flips {
+		x, y := int(i)%s.p.imageWidth, int(i)/s.p.imageWidth
+		if s.world[y][x] != 0 {
+			s.world[y][x] = 0x00
+		} else {
+			s.world[y][x] = 0xFF
+		}
+		s.emit(CellFlipped{CompletedTurns: s.turn, Cell: cell{x: x, y: y}})
+	}
+}
+
+// rewind moves the world back (or forward, if turns is negative) through the history while paused
+// and pushes the result to the workers, so that resuming carries on from there.
+// It stops early at either end of the history.
+func (s *distributorState) rewind(turns int) {
+	if s.history == nil || s.state != PAUSE {
+		return
+	}
+	s.fetchWorld()
+	for ; turns > 0; turns-- {
+		e, ok := s.history.back()
+		if !ok {
+			break
+		}
+		s.turn = e.turnBefore
+		s.applyFlips(e.flips)
+	}
+	for ; turns < 0; turns++ {
+		e, ok := s.history.forward()
+		if !ok {
+			break
+		}
+		s.turn = e.turnAfter
+		s.applyFlips(e.flips)
+	}
+	s.pushWorld()
+	s.d.metrics.setTurn(s.turn)
+}
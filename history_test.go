@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorldHistoryRing(t *testing.T) {
+	h := newWorldHistory(3)
+	for turn := 1; turn <= 5; turn++ {
+		h.push(historyEntry{turnBefore: turn - 1, turnAfter: turn})
+	}
+
+	// Only the newest 3 changes are kept
+	for _, turn := range []int{5, 4, 3} {
+		e, ok := h.back()
+		assert.True(t, ok)
+		assert.Equal(t, turn, e.turnAfter)
+	}
+	_, ok := h.back()
+	assert.False(t, ok)
+
+	e, ok := h.forward()
+	assert.True(t, ok)
+	assert.Equal(t, 3, e.turnAfter)
+
+	// Pushing while rewound drops the undone entries
+	h.push(historyEntry{turnBefore: 3, turnAfter: 4, flips: []int32{1}})
+	_, ok = h.forward()
+	assert.False(t, ok)
+	e, _ = h.back()
+	assert.Equal(t, []int32{1}, e.flips)
+	e, _ = h.back()
+	assert.Equal(t, 3, e.turnAfter)
+	_, ok = h.back()
+	assert.False(t, ok)
+
+	// A zero sized history never records anything
+	empty := newWorldHistory(0)
+	empty.push(historyEntry{turnAfter: 1})
+	_, ok = empty.back()
+	assert.False(t, ok)
+}
+
+func snapshot(control chan<- controlRequest) controlResponse {
+	reply := make(chan controlResponse, 1)
+	control <- controlRequest{command: controlSnapshot, reply: reply}
+	return <-reply
+}
+
+func TestRewind(t *testing.T) {
+	p := golParams{turns: 1000000000, threads: 4, imageWidth: 16, imageHeight: 16, history: 20}
+	key, control, finalAlive := startKeyTest(t, p, externalChans{})
+
+	sendKeys(key, "p")
+	a := snapshot(control)
+	sendKeys(key, "10n")
+	b := snapshot(control)
+	assert.NotEqual(t, a.world, b.world)
+
+	sendKeys(key, "10,")
+	rewound := snapshot(control)
+	assert.Equal(t, a.turn, rewound.turn)
+	assert.Equal(t, a.world, rewound.world)
+
+	sendKeys(key, "3.7.")
+	assert.Equal(t, b.world, snapshot(control).world)
+
+	// Resuming from a rewound state carries on from there
+	sendKeys(key, "4,4n")
+	stepped := snapshot(control)
+	assert.Equal(t, b.turn, stepped.turn)
+	assert.Equal(t, b.world, stepped.world)
+
+	// Edits can be undone too
+	sendKeys(key, "mhkc")
+	assert.Equal(t, 0, snapshot(control).alive)
+	sendKeys(key, ",")
+	assert.Equal(t, b.world, snapshot(control).world)
+
+	// The history only goes back p.history changes, one of which was the edit
+	oldest := b.turn - 19
+	if oldest < 0 {
+		oldest = 0
+	}
+	sendKeys(key, "100,")
+	assert.Equal(t, oldest, snapshot(control).turn)
+
+	sendKeys(key, "q")
+	<-finalAlive
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// controlCommand allows requesting behaviour from the distributor over the control chan.
+type controlCommand uint8
+
+const (
+	controlStatus controlCommand = iota
+	controlPause
+	controlResume
+	controlStep
+	controlSnapshot
+	controlQuit
+	controlSpeed
+	controlRunUntil
+)
+
+// controlRequest is sent to the distributor, which handles it inside its turn loop and answers on reply.
+type controlRequest struct {
+	command controlCommand
+	n       int // Turns for controlStep, turns per second for controlSpeed, turn to pause at for controlRunUntil
+	reply   chan<- controlResponse
+}
+
+// controlResponse describes the game after the distributor has handled a controlRequest.
+// alive is only filled in for controlStatus and controlSnapshot, world only for controlSnapshot.
+type controlResponse struct {
+	turn     int
+	state    progState
+	speed    int
+	runUntil int
+	alive    int
+	world    [][]byte
+}
+
+// statusJSON is the body returned by the status endpoint.
+type statusJSON struct {
+	Turn     int        `json:"turn"`
+	State    string     `json:"state"`
+	Alive    int        `json:"alive"`
+	Speed    int        `json:"speed"`
+	RunUntil int        `json:"runUntil"`
+	Params   paramsJSON `json:"params"`
+}
+
+type paramsJSON struct {
+	Turns   int `json:"turns"`
+	Threads int `json:"threads"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+}
+
+// maxStep is the most turns a single step request may ask for. The turns are made inside the distributor's loop,
+// which can't answer anything else until they are done, so longer runs have to go through /run instead.
+const maxStep = 1000
+
+// apiServer exposes the control chan of a running game over HTTP.
+type apiServer struct {
+	p       golParams
+	control chan<- controlRequest
+	broker  *eventBroker
+	done    <-chan struct{}
+	mux     *http.ServeMux
+}
+
+// newAPIServer returns a handler serving the HTTP control API.
+// broker may be nil, in which case the event stream is not available.
+// done must be closed once the game has finished so that requests stop waiting for the distributor.
+func newAPIServer(p golParams, control chan<- controlRequest, broker *eventBroker, done <-chan struct{}) http.Handler {
+	s := &apiServer{p: p, control: control, broker: broker, done: done, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/pause", s.handleCommand(controlPause))
+	s.mux.HandleFunc("/resume", s.handleCommand(controlResume))
+	s.mux.HandleFunc("/step", s.handleNumber(controlStep, "n", 1, maxStep))
+	s.mux.HandleFunc("/speed", s.handleNumber(controlSpeed, "tps", 0, 0))
+	s.mux.HandleFunc("/run", s.handleNumber(controlRunUntil, "until", -1, 0))
+	s.mux.HandleFunc("/snapshot", s.handleSnapshot)
+	s.mux.HandleFunc("/quit", s.handleCommand(controlQuit))
+	s.mux.HandleFunc("/events", s.handleEvents)
+	return s
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// send passes a request to the distributor and waits for its response.
+// It returns false if the game finished before the request could be handled.
+func (s *apiServer) send(command controlCommand, n int) (controlResponse, bool) {
+	reply := make(chan controlResponse, 1)
+	select {
+	case s.control <- controlRequest{command: command, n: n, reply: reply}:
+	case <-s.done:
+		return controlResponse{}, false
+	}
+	select {
+	case res := <-reply:
+		return res, true
+	case <-s.done:
+		return controlResponse{}, false
+	}
+}
+
+func (s *apiServer) writeStatus(w http.ResponseWriter, res controlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statusJSON{
+		Turn:     res.turn,
+		State:    res.state.String(),
+		Alive:    res.alive,
+		Speed:    res.speed,
+		RunUntil: res.runUntil,
+		Params: paramsJSON{
+			Turns:   s.p.turns,
+			Threads: s.p.threads,
+			Width:   s.p.imageWidth,
+			Height:  s.p.imageHeight,
+		},
+	})
+}
+
+func (s *apiServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res, ok := s.send(controlStatus, 0)
+	if !ok {
+		http.Error(w, "game has finished", http.StatusServiceUnavailable)
+		return
+	}
+	s.writeStatus(w, res)
+}
+
+// handleCommand returns a handler for commands that take no arguments.
+func (s *apiServer) handleCommand(command controlCommand) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		res, ok := s.send(command, 0)
+		if !ok {
+			http.Error(w, "game has finished", http.StatusServiceUnavailable)
+			return
+		}
+		s.writeStatus(w, res)
+	}
+}
+
+// handleNumber returns a handler for commands that take a non-negative number from the query parameter name.
+// A negative def makes the parameter required, and a max of 0 leaves it unlimited.
+func (s *apiServer) handleNumber(command controlCommand, name string, def int, max int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n := def
+		if value := r.URL.Query().Get(name); value != "" {
+			var err error
+			n, err = strconv.Atoi(value)
+			if err != nil || n < 0 {
+				n = -1
+			}
+		}
+		if n < 0 {
+			http.Error(w, name+" must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		if max > 0 && n > max {
+			http.Error(w, fmt.Sprintf("%s must be no more than %d", name, max), http.StatusBadRequest)
+			return
+		}
+		res, ok := s.send(command, n)
+		if !ok {
+			http.Error(w, "game has finished", http.StatusServiceUnavailable)
+			return
+		}
+		s.writeStatus(w, res)
+	}
+}
+
+func (s *apiServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pgm"
+	}
+	if format != "pgm" && format != "png" {
+		http.Error(w, "format must be pgm or png", http.StatusBadRequest)
+		return
+	}
+	res, ok := s.send(controlSnapshot, 0)
+	if !ok {
+		http.Error(w, "game has finished", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("X-Turn", strconv.Itoa(res.turn))
+	switch format {
+	case "pgm":
+		w.Header().Set("Content-Type", "image/x-portable-graymap")
+		_ = encodePgm(w, s.p.imageWidth, s.p.imageHeight, res.world)
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		_ = styleFor(s.p).encodePng(w, s.p.imageWidth, s.p.imageHeight, res.world)
+	}
+}
+
+// eventBufferSize is the number of events buffered for each event stream client before events are dropped.
+const eventBufferSize = 4096
+
+// eventJSON returns the SSE event name and JSON payload for an event.
+func eventJSON(e Event) (string, interface{}) {
+	switch e := e.(type) {
+	case AliveCellsCount:
+		return "alive", struct {
+			Turn  int `json:"turn"`
+			Count int `json:"count"`
+		}{e.CompletedTurns, e.CellsCount}
+	case TurnComplete:
+		return "turn", struct {
+			Turn int `json:"turn"`
+		}{e.CompletedTurns}
+	case CellFlipped:
+		return "flipped", struct {
+			Turn int `json:"turn"`
+			X    int `json:"x"`
+			Y    int `json:"y"`
+		}{e.CompletedTurns, e.Cell.x, e.Cell.y}
+	case StateChange:
+		return "state", struct {
+			Turn  int    `json:"turn"`
+			State string `json:"state"`
+		}{e.CompletedTurns, e.NewState.String()}
+	case FinalTurnComplete:
+		return "final", struct {
+			Turn  int `json:"turn"`
+			Alive int `json:"alive"`
+		}{e.CompletedTurns, len(e.Alive)}
+	case ImageOutputComplete:
+		return "snapshot", struct {
+			Turn     int    `json:"turn"`
+			Filename string `json:"filename"`
+		}{e.CompletedTurns, e.Filename}
+	case CycleDetected:
+		return "cycle", struct {
+			Turn   int `json:"turn"`
+			Start  int `json:"start"`
+			Period int `json:"period"`
+		}{e.CompletedTurns, e.Start, e.Period}
+	}
+	return "unknown", struct {
+		Turn int `json:"turn"`
+	}{e.GetCompletedTurns()}
+}
+
+// writeSSE writes a single Server-Sent Event.
+func writeSSE(w http.ResponseWriter, name string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+	return err
+}
+
+// handleEvents streams game events as Server-Sent Events until the client disconnects or the game ends.
+// The optional types query parameter is a comma separated list of event names to send, e.g. types=turn,alive.
+// Clients that fall behind miss events; they are told how many with a "dropped" event.
+func (s *apiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.broker == nil {
+		http.NotFound(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var accept func(Event) bool
+	if types := r.URL.Query().Get("types"); types != "" {
+		wanted := make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			wanted[strings.TrimSpace(t)] = true
+		}
+		accept = func(e Event) bool {
+			name, _ := eventJSON(e)
+			return wanted[name]
+		}
+	}
+
+	sub := s.broker.subscribe(eventBufferSize, accept)
+	defer s.broker.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if dropped := sub.takeDropped(); dropped > 0 {
+				if writeSSE(w, "dropped", struct {
+					Count uint64 `json:"count"`
+				}{dropped}) != nil {
+					return
+				}
+			}
+			name, data := eventJSON(e)
+			if writeSSE(w, name, data) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
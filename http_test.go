@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPControl(t *testing.T) {
+	p := golParams{turns: 1000000000, threads: 4, imageWidth: 16, imageHeight: 16}
+	_, control, finalAlive := startKeyTest(t, p, externalChans{})
+	done := make(chan struct{})
+
+	server := httptest.NewServer(newAPIServer(p, control, nil, done))
+	defer server.Close()
+
+	request := func(method, path string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	status := func(res *http.Response) statusJSON {
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var s statusJSON
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&s))
+		return s
+	}
+
+	paused := status(request(http.MethodPost, "/pause"))
+	assert.Equal(t, "paused", paused.State)
+
+	s := status(request(http.MethodGet, "/status"))
+	assert.Equal(t, paused.Turn, s.Turn)
+	assert.Equal(t, 5, s.Alive) // The glider never changes size
+	assert.Equal(t, paramsJSON{Turns: p.turns, Threads: 4, Width: 16, Height: 16}, s.Params)
+
+	stepped := status(request(http.MethodPost, "/step?n=4"))
+	assert.Equal(t, paused.Turn+4, stepped.Turn)
+	assert.Equal(t, "paused", stepped.State)
+
+	s = status(request(http.MethodPost, "/speed?tps=50"))
+	assert.Equal(t, 50, s.Speed)
+	s = status(request(http.MethodPost, "/speed"))
+	assert.Equal(t, 0, s.Speed)
+
+	s = status(request(http.MethodPost, "/run?until="+strconv.Itoa(stepped.Turn+100)))
+	assert.Equal(t, "running", s.State)
+	assert.Equal(t, stepped.Turn+100, waitForPause(t, control).turn)
+
+	res := request(http.MethodPost, "/run")
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = request(http.MethodGet, "/snapshot?format=pgm")
+	var body bytes.Buffer
+	_, err := body.ReadFrom(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "image/x-portable-graymap", res.Header.Get("Content-Type"))
+	header := []byte("P5\n16 16\n255\n")
+	require.True(t, bytes.HasPrefix(body.Bytes(), header))
+	assert.Len(t, body.Bytes(), len(header)+16*16)
+	assert.Equal(t, 5, bytes.Count(body.Bytes()[len(header):], []byte{0xFF}))
+
+	res = request(http.MethodGet, "/snapshot?format=png")
+	img, err := png.Decode(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 16, img.Bounds().Dx())
+
+	res = request(http.MethodGet, "/snapshot?format=bmp")
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = request(http.MethodPost, "/step?n=-1")
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = request(http.MethodPost, "/step?n="+strconv.Itoa(maxStep+1))
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = request(http.MethodPost, "/status")
+	res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	assert.Equal(t, "stopped", status(request(http.MethodPost, "/quit")).State)
+	assert.Len(t, <-finalAlive, 5)
+	close(done)
+
+	res = request(http.MethodGet, "/status")
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestHTTPEvents(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{
+		turns:       1000000000,
+		threads:     2,
+		imageWidth:  16,
+		imageHeight: 16,
+		output:      filepath.Join(dir, "{width}x{height}-{turns}"),
+	}
+	control := make(chan controlRequest)
+	done := make(chan struct{})
+	events := make(chan Event, eventBufferSize)
+	broker := newEventBroker()
+	go broker.run(events)
+
+	server := httptest.NewServer(newAPIServer(p, control, broker, done))
+	defer server.Close()
+
+	// Subscribe before starting the game so that no events are missed
+	stream, err := http.Get(server.URL + "/events?types=state,snapshot")
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+
+	go func() {
+		_, err := runGameOfLife(p, externalChans{control: control, events: events})
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	for _, path := range []string{"/pause", "/quit"} {
+		res, err := http.Post(server.URL+path, "", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	var names []string
+	var data []string
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			names = append(names, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Equal(t, []string{"state", "state", "snapshot"}, names)
+	assert.Contains(t, data[0], `"state":"paused"`)
+	assert.Contains(t, data[1], `"state":"stopped"`)
+	filename, err := json.Marshal(filepath.Join(dir, "16x16-1000000000.pgm"))
+	require.NoError(t, err)
+	assert.Contains(t, data[2], `"filename":`+string(filename))
+}
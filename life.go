@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// boundingBox sets the size of a relative pattern to the smallest box around its alive cells.
+func boundingBox(pat *lifePattern) {
+	if len(pat.alive) == 0 {
+		return
+	}
+	min, max := pat.alive[0], pat.alive[0]
+	for _, c := range pat.alive {
+		if c.x < min.x {
+			min.x = c.x
+		}
+		if c.y < min.y {
+			min.y = c.y
+		}
+		if c.x > max.x {
+			max.x = c.x
+		}
+		if c.y > max.y {
+			max.y = c.y
+		}
+	}
+	pat.width = max.x - min.x + 1
+	pat.height = max.y - min.y + 1
+}
+
+// parseLife106 reads a Life 1.06 pattern: a "#Life 1.06" header followed by one "x y" line per alive cell.
+func parseLife106(r io.Reader) (lifePattern, error) {
+	pat := lifePattern{rule: conwayRule, relative: true}
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		line++
+		switch {
+		case line == 1:
+			if !strings.HasPrefix(text, "#Life 1.06") {
+				return pat, fmt.Errorf("life 1.06: missing #Life 1.06 header")
+			}
+		case text == "":
+		case strings.HasPrefix(text, "#"):
+			pat.comments = append(pat.comments, strings.TrimSpace(strings.TrimPrefix(text, "#D")))
+		default:
+			fields := strings.Fields(text)
+			if len(fields) != 2 {
+				return pat, fmt.Errorf("life 1.06: line %d should be \"x y\"", line)
+			}
+			x, errX := strconv.Atoi(fields[0])
+			y, errY := strconv.Atoi(fields[1])
+			if errX != nil || errY != nil {
+				return pat, fmt.Errorf("life 1.06: invalid coordinates on line %d", line)
+			}
+			pat.alive = append(pat.alive, cell{x: x, y: y})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	if line == 0 {
+		return pat, fmt.Errorf("life 1.06: missing #Life 1.06 header")
+	}
+	boundingBox(&pat)
+	return pat, nil
+}
+
+// encodeLife106 writes the alive cells of world to w as a Life 1.06 pattern,
+// with coordinates relative to the middle of the board.
+func encodeLife106(w io.Writer, width, height int, world [][]byte, comments ...string) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString("#Life 1.06\n")
+	for _, comment := range comments {
+		fmt.Fprintf(buf, "#D %s\n", comment)
+	}
+	for _, c := range relativeCells(width, height, world) {
+		fmt.Fprintf(buf, "%d %d\n", c.x, c.y)
+	}
+	return buf.Flush()
+}
+
+// parseLife105 reads a Life 1.05 pattern: a "#Life 1.05" header, optional #D descriptions and
+// #N or #R rule lines, then blocks of '.' and '*' rows each starting with a "#P x y" position.
+func parseLife105(r io.Reader) (lifePattern, error) {
+	pat := lifePattern{rule: conwayRule, relative: true}
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	blockX, y := 0, 0
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		line++
+		switch {
+		case line == 1:
+			if !strings.HasPrefix(text, "#Life 1.05") {
+				return pat, fmt.Errorf("life 1.05: missing #Life 1.05 header")
+			}
+		case strings.HasPrefix(text, "#D") || strings.HasPrefix(text, "#C"):
+			pat.comments = append(pat.comments, strings.TrimSpace(text[2:]))
+		case strings.HasPrefix(text, "#N"):
+			pat.rule = conwayRule
+		case strings.HasPrefix(text, "#R"):
+			pat.rule = normaliseRule(text[2:])
+		case strings.HasPrefix(text, "#P"):
+			fields := strings.Fields(text[2:])
+			if len(fields) != 2 {
+				return pat, fmt.Errorf("life 1.05: line %d should be \"#P x y\"", line)
+			}
+			var errX, errY error
+			blockX, errX = strconv.Atoi(fields[0])
+			y, errY = strconv.Atoi(fields[1])
+			if errX != nil || errY != nil {
+				return pat, fmt.Errorf("life 1.05: invalid position on line %d", line)
+			}
+		case strings.HasPrefix(text, "#"):
+			// Other # lines are unknown extensions and ignored
+		default:
+			for x, c := range text {
+				switch c {
+				case '.':
+				case '*', 'O':
+					pat.alive = append(pat.alive, cell{x: blockX + x, y: y})
+				default:
+					return pat, fmt.Errorf("life 1.05: unexpected character %q on line %d", c, line)
+				}
+			}
+			y++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	if line == 0 {
+		return pat, fmt.Errorf("life 1.05: missing #Life 1.05 header")
+	}
+	boundingBox(&pat)
+	return pat, nil
+}
+
+// encodeLife105 writes the alive cells of world to w as a single Life 1.05 block,
+// positioned relative to the middle of the board.
+func encodeLife105(w io.Writer, width, height int, world [][]byte, comments ...string) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString("#Life 1.05\n")
+	for _, comment := range comments {
+		fmt.Fprintf(buf, "#D %s\n", comment)
+	}
+	buf.WriteString("#N\n")
+
+	pat := lifePattern{alive: relativeCells(width, height, world)}
+	if len(pat.alive) == 0 {
+		return buf.Flush()
+	}
+	boundingBox(&pat)
+	originX, originY := pat.alive[0].x, pat.alive[0].y
+	for _, c := range pat.alive {
+		if c.x < originX {
+			originX = c.x
+		}
+	}
+	fmt.Fprintf(buf, "#P %d %d\n", originX, originY)
+
+	for y := originY; y < originY+pat.height; y++ {
+		row := []byte(strings.Repeat(".", pat.width))
+		end := 1 // Empty rows are written as a single '.'
+		for x := originX; x < originX+pat.width; x++ {
+			if world[y+height/2][x+width/2] != 0 {
+				row[x-originX] = '*'
+				end = x - originX + 1
+			}
+		}
+		buf.Write(row[:end])
+		buf.WriteByte('\n')
+	}
+	return buf.Flush()
+}
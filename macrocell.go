@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxMacrocellLevel keeps node sizes (2^level) well inside an int.
+const maxMacrocellLevel = 60
+
+// mcNode is a node of a macrocell quadtree, covering a 2^level square of cells.
+// Level 3 nodes may be leaves with their 8x8 cells stored as one bit mask per row,
+// level 1 nodes hold cell states and every other node points to four children.
+// Child and node index 0 is always an empty node.
+type mcNode struct {
+	level    int
+	rows     [8]uint8 // Leaves only, bit x of rows[y] is cell (x, y)
+	leaf     bool
+	children [4]int // nw, ne, sw, se: node indices, or cell states for level 1 nodes
+}
+
+// macrocell is a quadtree read from a Golly macrocell file.
+// nodes[0] is unused so that indices match the file, where nodes are numbered from 1.
+type macrocell struct {
+	nodes []mcNode
+	root  int
+
+	boxes map[int]mcBox // Memoised results of box
+}
+
+// mcBox is the bounding box of the alive cells in a node, relative to its top left corner.
+type mcBox struct {
+	minX, minY, maxX, maxY int
+	empty                  bool
+}
+
+func (b mcBox) union(o mcBox, dx, dy int) mcBox {
+	if o.empty {
+		return b
+	}
+	o.minX, o.maxX, o.minY, o.maxY = o.minX+dx, o.maxX+dx, o.minY+dy, o.maxY+dy
+	if b.empty {
+		return o
+	}
+	if o.minX < b.minX {
+		b.minX = o.minX
+	}
+	if o.minY < b.minY {
+		b.minY = o.minY
+	}
+	if o.maxX > b.maxX {
+		b.maxX = o.maxX
+	}
+	if o.maxY > b.maxY {
+		b.maxY = o.maxY
+	}
+	return b
+}
+
+// box returns the bounding box of the alive cells in node i without expanding the tree.
+func (m *macrocell) box(i int) mcBox {
+	if i == 0 {
+		return mcBox{empty: true}
+	}
+	if b, ok := m.boxes[i]; ok {
+		return b
+	}
+	n := m.nodes[i]
+	b := mcBox{empty: true}
+	switch {
+	case n.leaf:
+		for y, row := range n.rows {
+			for x := 0; x < 8; x++ {
+				if row&(1<<uint(x)) != 0 {
+					b = b.union(mcBox{minX: x, minY: y, maxX: x, maxY: y}, 0, 0)
+				}
+			}
+		}
+	case n.level == 1:
+		for q, state := range n.children {
+			if state != 0 {
+				b = b.union(mcBox{}, q%2, q/2)
+			}
+		}
+	default:
+		half := 1 << uint(n.level-1)
+		for q, child := range n.children {
+			b = b.union(m.box(child), q%2*half, q/2*half)
+		}
+	}
+	m.boxes[i] = b
+	return b
+}
+
+// draw sets the alive cells of node i, whose top left corner is at (x, y), in world.
+// The node must fit in the world.
+func (m *macrocell) draw(world [][]byte, i, x, y int) {
+	if i == 0 {
+		return
+	}
+	n := m.nodes[i]
+	switch {
+	case n.leaf:
+		for dy, row := range n.rows {
+			for dx := 0; dx < 8; dx++ {
+				if row&(1<<uint(dx)) != 0 {
+					world[y+dy][x+dx] = 0xFF
+				}
+			}
+		}
+	case n.level == 1:
+		for q, state := range n.children {
+			if state != 0 {
+				world[y+q/2][x+q%2] = 0xFF
+			}
+		}
+	default:
+		half := 1 << uint(n.level-1)
+		for q, child := range n.children {
+			if !m.box(child).empty {
+				m.draw(world, child, x+q%2*half, y+q/2*half)
+			}
+		}
+	}
+}
+
+// relativeBox returns the bounding box of the whole pattern relative to the middle of the root node,
+// which is where Golly puts the origin.
+func (m *macrocell) relativeBox() mcBox {
+	b := m.box(m.root)
+	if b.empty {
+		return b
+	}
+	half := 1 << uint(m.nodes[m.root].level-1)
+	return mcBox{minX: b.minX - half, minY: b.minY - half, maxX: b.maxX - half, maxY: b.maxY - half}
+}
+
+// placeMacrocell draws the tree on a board of the size given by p, with its origin in the middle of the board.
+// It fails without expanding anything if the pattern is too big for the board.
+func placeMacrocell(p golParams, m *macrocell) ([][]byte, error) {
+	world := emptyWorld(p)
+	b := m.relativeBox()
+	if b.empty {
+		return world, nil
+	}
+	if b.minX+p.imageWidth/2 < 0 || b.minY+p.imageHeight/2 < 0 ||
+		b.maxX+p.imageWidth/2 >= p.imageWidth || b.maxY+p.imageHeight/2 >= p.imageHeight {
+		return nil, fmt.Errorf("%dx%d macrocell pattern does not fit on a %dx%d board",
+			b.maxX-b.minX+1, b.maxY-b.minY+1, p.imageWidth, p.imageHeight)
+	}
+
+	// Only the non-empty part of the tree is visited, so nodes far outside the board are never touched
+	half := 1 << uint(m.nodes[m.root].level-1)
+	var visit func(i, x, y int)
+	visit = func(i, x, y int) {
+		nb := m.box(i)
+		if nb.empty {
+			return
+		}
+		size := 1 << uint(m.nodes[i].level)
+		if x >= 0 && y >= 0 && x+size <= p.imageWidth && y+size <= p.imageHeight {
+			m.draw(world, i, x, y)
+			return
+		}
+		n := m.nodes[i]
+		if n.leaf || n.level == 1 {
+			// Partly off the board, but its alive cells are known to be on it
+			for cy := nb.minY; cy <= nb.maxY; cy++ {
+				for cx := nb.minX; cx <= nb.maxX; cx++ {
+					if m.alive(i, cx, cy) {
+						world[y+cy][x+cx] = 0xFF
+					}
+				}
+			}
+			return
+		}
+		childHalf := size / 2
+		for q, child := range n.children {
+			visit(child, x+q%2*childHalf, y+q/2*childHalf)
+		}
+	}
+	visit(m.root, p.imageWidth/2-half, p.imageHeight/2-half)
+	return world, nil
+}
+
+// alive reports whether cell (x, y) of a leaf or level 1 node is alive.
+func (m *macrocell) alive(i, x, y int) bool {
+	n := m.nodes[i]
+	if n.leaf {
+		return n.rows[y]&(1<<uint(x)) != 0
+	}
+	return n.children[y*2+x] != 0
+}
+
+// parseMacrocellLeaf reads an 8x8 leaf written as rows of '.' and '*' ending in '$'.
+func parseMacrocellLeaf(line string) (mcNode, error) {
+	n := mcNode{level: 3, leaf: true}
+	x, y := 0, 0
+	for _, c := range line {
+		if y >= 8 {
+			return n, errors.New("macrocell: leaf has more than 8 rows")
+		}
+		switch c {
+		case '.':
+			x++
+		case '*':
+			if x >= 8 {
+				return n, errors.New("macrocell: leaf row has more than 8 cells")
+			}
+			n.rows[y] |= 1 << uint(x)
+			x++
+		case '$':
+			x = 0
+			y++
+		default:
+			return n, fmt.Errorf("macrocell: unexpected character %q in leaf", c)
+		}
+	}
+	return n, nil
+}
+
+// parseMacrocellNode reads a "level nw ne sw se" line.
+func parseMacrocellNode(line string, count int) (mcNode, error) {
+	var n mcNode
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		return n, fmt.Errorf("macrocell: node %d should be \"level nw ne sw se\"", count)
+	}
+	level, err := strconv.Atoi(fields[0])
+	if err != nil || level < 1 || level > maxMacrocellLevel {
+		return n, fmt.Errorf("macrocell: node %d has invalid level %q", count, fields[0])
+	}
+	n.level = level
+	for q := range n.children {
+		child, err := strconv.Atoi(fields[q+1])
+		if err != nil || child < 0 {
+			return n, fmt.Errorf("macrocell: node %d has invalid child %q", count, fields[q+1])
+		}
+		n.children[q] = child
+	}
+	return n, nil
+}
+
+// parseMacrocell reads a Golly macrocell (.mc) file.
+// The quadtree is kept as it is rather than expanded, so huge sparse patterns stay cheap until they are placed.
+func parseMacrocell(r io.Reader) (lifePattern, error) {
+	pat := lifePattern{rule: conwayRule, relative: true}
+	m := &macrocell{nodes: []mcNode{{}}, boxes: make(map[int]mcBox)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		line++
+		switch {
+		case line == 1:
+			if !strings.HasPrefix(text, "[M2]") {
+				return pat, errors.New("macrocell: missing [M2] header")
+			}
+		case text == "":
+		case strings.HasPrefix(text, "#R"):
+			pat.rule = normaliseRule(text[2:])
+		case strings.HasPrefix(text, "#C") || strings.HasPrefix(text, "#D"):
+			pat.comments = append(pat.comments, strings.TrimSpace(text[2:]))
+		case strings.HasPrefix(text, "#"):
+			// Generation counts, frames and other Golly metadata are ignored
+		default:
+			var n mcNode
+			var err error
+			if text[0] >= '0' && text[0] <= '9' {
+				n, err = parseMacrocellNode(text, len(m.nodes))
+			} else {
+				n, err = parseMacrocellLeaf(text)
+			}
+			if err != nil {
+				return pat, err
+			}
+			if !n.leaf && n.level > 1 {
+				for _, child := range n.children {
+					if child >= len(m.nodes) {
+						return pat, fmt.Errorf("macrocell: node %d refers to later node %d", len(m.nodes), child)
+					}
+					if child != 0 && m.nodes[child].level != n.level-1 {
+						return pat, fmt.Errorf("macrocell: node %d at level %d has a child at level %d", len(m.nodes), n.level, m.nodes[child].level)
+					}
+				}
+			}
+			m.nodes = append(m.nodes, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	if line == 0 {
+		return pat, errors.New("macrocell: missing [M2] header")
+	}
+
+	// The last node is the root; a file with no nodes is an empty pattern
+	if len(m.nodes) > 1 {
+		m.root = len(m.nodes) - 1
+		if b := m.relativeBox(); !b.empty {
+			pat.width = b.maxX - b.minX + 1
+			pat.height = b.maxY - b.minY + 1
+		}
+		pat.tree = m
+	}
+	return pat, nil
+}
+
+// mcWriter builds a deduplicated quadtree, numbering nodes in the order they are first written.
+type mcWriter struct {
+	buf    *bufio.Writer
+	world  [][]byte
+	width  int
+	height int
+	left   int // Board column of the tree's left edge, may be negative
+	top    int
+	leaves map[[8]uint8]int
+	nodes  map[[5]int]int
+	count  int
+}
+
+// leaf returns the index of the 8x8 leaf at (x, y) in tree coordinates, writing it if it is new.
+func (w *mcWriter) leaf(x, y int) int {
+	var rows [8]uint8
+	empty := true
+	for dy := 0; dy < 8; dy++ {
+		by := w.top + y + dy
+		if by < 0 || by >= w.height {
+			continue
+		}
+		for dx := 0; dx < 8; dx++ {
+			bx := w.left + x + dx
+			if bx >= 0 && bx < w.width && w.world[by][bx] != 0 {
+				rows[dy] |= 1 << uint(dx)
+				empty = false
+			}
+		}
+	}
+	if empty {
+		return 0
+	}
+	if i, ok := w.leaves[rows]; ok {
+		return i
+	}
+
+	// Trailing dead cells and rows are left out
+	var line strings.Builder
+	last := 7
+	for last >= 0 && rows[last] == 0 {
+		last--
+	}
+	for dy := 0; dy <= last; dy++ {
+		for dx := 0; dx < 8 && rows[dy]>>uint(dx) != 0; dx++ {
+			if rows[dy]&(1<<uint(dx)) != 0 {
+				line.WriteByte('*')
+			} else {
+				line.WriteByte('.')
+			}
+		}
+		line.WriteByte('$')
+	}
+	w.buf.WriteString(line.String())
+	w.buf.WriteByte('\n')
+	w.count++
+	w.leaves[rows] = w.count
+	return w.count
+}
+
+// node returns the index of the node of the given level at (x, y) in tree coordinates, writing it if it is new.
+func (w *mcWriter) node(level, x, y int) int {
+	if level == 3 {
+		return w.leaf(x, y)
+	}
+	half := 1 << uint(level-1)
+	key := [5]int{
+		level,
+		w.node(level-1, x, y),
+		w.node(level-1, x+half, y),
+		w.node(level-1, x, y+half),
+		w.node(level-1, x+half, y+half),
+	}
+	if key[1] == 0 && key[2] == 0 && key[3] == 0 && key[4] == 0 {
+		return 0
+	}
+	if i, ok := w.nodes[key]; ok {
+		return i
+	}
+	fmt.Fprintf(w.buf, "%d %d %d %d %d\n", key[0], key[1], key[2], key[3], key[4])
+	w.count++
+	w.nodes[key] = w.count
+	return w.count
+}
+
+// encodeMacrocell writes world to w as a Golly macrocell file, with the middle of the board at the origin.
+func encodeMacrocell(w io.Writer, width, height int, world [][]byte, comments ...string) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString("[M2] (gameoflife)\n")
+	fmt.Fprintf(buf, "#R %s\n", conwayRule)
+	for _, comment := range comments {
+		fmt.Fprintf(buf, "#C %s\n", comment)
+	}
+
+	// The root must reach from the origin to every edge of the board
+	level := 3
+	for half := 4; half < width-width/2 || half < height-height/2 || half < width/2 || half < height/2; half *= 2 {
+		level++
+	}
+	half := 1 << uint(level-1)
+	mw := &mcWriter{
+		buf:    buf,
+		world:  world,
+		width:  width,
+		height: height,
+		left:   width/2 - half,
+		top:    height/2 - half,
+		leaves: make(map[[8]uint8]int),
+		nodes:  make(map[[5]int]int),
+	}
+	mw.node(level, 0, 0)
+	return buf.Flush()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMacrocell(t *testing.T) {
+	pat, err := parseMacrocell(strings.NewReader(`[M2] (golly 2.0)
+#R B3/S23
+#C A glider
+#G 0
+$$..*$...*$.***$
+4 0 0 0 1
+`))
+	require.NoError(t, err)
+	assert.Equal(t, conwayRule, pat.rule)
+	assert.Equal(t, []string{"A glider"}, pat.comments)
+	assert.Equal(t, 3, pat.width)
+	assert.Equal(t, 3, pat.height)
+
+	world, err := placePattern(golParams{imageWidth: 16, imageHeight: 16}, pat)
+	require.NoError(t, err)
+	assert.Equal(t, []cell{{10, 10}, {11, 11}, {9, 12}, {10, 12}, {11, 12}}, aliveCells(world))
+}
+
+func TestParseMacrocellMultiState(t *testing.T) {
+	pat, err := parseMacrocell(strings.NewReader("[M2]\n1 0 1 2 0\n2 1 0 0 1\n"))
+	require.NoError(t, err)
+	world, err := placePattern(golParams{imageWidth: 8, imageHeight: 8}, pat)
+	require.NoError(t, err)
+	assert.Equal(t, []cell{{3, 2}, {2, 3}, {5, 4}, {4, 5}}, aliveCells(world))
+}
+
+// deepMacrocell returns a macrocell file with a glider leaf at the given corner of a chain of nodes up to level.
+func deepMacrocell(level int, rootChildren string) string {
+	var b strings.Builder
+	b.WriteString("[M2]\n.*$..*$***$\n")
+	for l := 4; l < level; l++ {
+		fmt.Fprintf(&b, "%d %d 0 0 0\n", l, l-3)
+	}
+	fmt.Fprintf(&b, "%d %s\n", level, strings.Replace(rootChildren, "c", fmt.Sprint(level-3), -1))
+	return b.String()
+}
+
+func TestMacrocellHugeSparse(t *testing.T) {
+	// A glider at the origin of a level 50 tree is placed without expanding the rest of the tree
+	pat, err := parseMacrocell(strings.NewReader(deepMacrocell(50, "0 0 0 c")))
+	require.NoError(t, err)
+	world, err := placePattern(golParams{imageWidth: 16, imageHeight: 16}, pat)
+	require.NoError(t, err)
+	assert.Equal(t, []cell{{9, 8}, {10, 9}, {8, 10}, {9, 10}, {10, 10}}, aliveCells(world))
+
+	// Two gliders 2^49 cells apart can't fit, which is found from the bounding box alone
+	pat, err = parseMacrocell(strings.NewReader(deepMacrocell(50, "c 0 0 c")))
+	require.NoError(t, err)
+	assert.Equal(t, 1<<49+3, pat.width)
+	_, err = placePattern(golParams{imageWidth: 512, imageHeight: 512}, pat)
+	assert.Error(t, err)
+}
+
+func TestParseMacrocellErrors(t *testing.T) {
+	for name, mc := range map[string]string{
+		"no header":      "4 0 0 0 1\n",
+		"empty":          "",
+		"later child":    "[M2]\n4 0 0 0 1\n",
+		"wrong level":    "[M2]\n*$\n5 0 0 0 1\n",
+		"bad level":      "[M2]\n*$\n99 0 0 0 1\n",
+		"short node":     "[M2]\n*$\n4 0 1\n",
+		"bad leaf":       "[M2]\n*x$\n",
+		"wide leaf":      "[M2]\n.........*$\n",
+		"tall leaf":      "[M2]\n$$$$$$$$*$\n",
+		"negative child": "[M2]\n*$\n4 -1 0 0 1\n",
+	} {
+		_, err := parseMacrocell(strings.NewReader(mc))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEncodeMacrocellDeduplicates(t *testing.T) {
+	// Sixteen identical blocks, one in each 8x8 square, need one leaf and one node per level
+	p := golParams{imageWidth: 32, imageHeight: 32}
+	world := emptyWorld(p)
+	for y := 0; y < 32; y += 8 {
+		for x := 0; x < 32; x += 8 {
+			world[y+1][x+1], world[y+1][x+2], world[y+2][x+1], world[y+2][x+2] = 0xFF, 0xFF, 0xFF, 0xFF
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, encodeMacrocell(&buf, 32, 32, world))
+	assert.Equal(t, "[M2] (gameoflife)\n#R B3/S23\n$.**$.**$\n4 1 1 1 1\n5 2 2 2 2\n", buf.String())
+
+	pat, err := parseMacrocell(&buf)
+	require.NoError(t, err)
+	decoded, err := placePattern(p, pat)
+	require.NoError(t, err)
+	assert.Equal(t, world, decoded)
+}
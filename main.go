@@ -1,7 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
 )
 
 // golParams provides the details of how to run the Game of Life and which image to load.
@@ -10,6 +18,30 @@ type golParams struct {
 	threads     int
 	imageWidth  int
 	imageHeight int
+	history     int // Number of changes to the world kept for rewinding, 0 disables it
+	threshold   int // Grey level (0-255) that pgm pixels must be brighter than to be alive
+
+	pattern      string // File in images/ to start from instead of WxH.pgm, in the format given by its extension
+	outputFormat string // Format of output images, one of the keys of outputFormats, defaulting to outputFormatName
+	input        string // Path to start from instead of pattern, "-" for stdin
+	output       string // Template for output paths, "-" for stdout, defaulting to defaultOutput
+
+	scale    int    // Pixels per cell in png, gif and video images, defaulting to 1
+	palette  string // Colours of png and gif images, one of the keys of palettes, defaulting to "mono"
+	gifEvery int    // Turns between frames of the gif written at the end of the run, 0 disables it
+
+	videoOut    string // File to stream frames to, "-" for stdout, or "" for no video
+	videoFormat string // "y4m" or "raw", defaulting to "y4m"
+	videoEvery  int    // Turns between video frames, defaulting to 1
+
+	traceOut  string // Template for the path of a trace of every worker's turns, "-" for stdout, or "" for no trace
+	censusOut string // Template for the path of a census of the objects in the final world, "-" for stdout, or "" for none
+
+	cycleLimit int  // Longest period of oscillation looked for, 0 disables cycle detection
+	cycleStop  bool // Whether the game ends once a cycle is found
+
+	quiet      bool      // Whether to leave out the messages about what the game is doing
+	messageOut io.Writer // Where the messages are printed, os.Stdout if nil
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -19,12 +51,14 @@ type ioCommand uint8
 // It will evaluate to:
 //		ioOutput 	= 0
 //		ioInput 	= 1
-//		ioCheckIdle = 2
+//		ioFrame 	= 2
+//		ioAnimation = 3
 
 const (
 	ioOutput ioCommand = iota
 	ioInput
-	ioCheckIdle
+	ioFrame
+	ioAnimation
 )
 
 type progState uint8
@@ -36,34 +70,75 @@ const (
 	CONTINUE
 )
 
+// String returns the name used for the state in status reports.
+func (s progState) String() string {
+	switch s {
+	case STOP:
+		return "stopped"
+	case PAUSE:
+		return "paused"
+	case CONTINUE:
+		return "running"
+	}
+	return "unknown"
+}
+
 // cell is used as the return type for the testing framework.
 type cell struct {
 	x, y int
 }
 
+// gameResult is sent by the distributor once the game has ended, with either the alive cells or what went wrong.
+type gameResult struct {
+	alive []cell
+	err   error
+}
+
 // distributorToIo defines all chans that the distributor goroutine will have to communicate with the io goroutine.
 // Note the restrictions on chans being send-only or receive-only to prevent bugs.
 type distributorToIo struct {
 	command   chan<- ioCommand
-	idle      <-chan bool
 	outputVal chan<- uint8
 	filename  chan<- string
 	inputVal  <-chan uint8
+	err       <-chan error
 }
 
 // ioToDistributor defines all chans that the io goroutine will have to communicate with the distributor goroutine.
 // Note the restrictions on chans being send-only or receive-only to prevent bugs.
 type ioToDistributor struct {
 	command   <-chan ioCommand
-	idle      chan<- bool
 	outputVal <-chan uint8
 	filename  <-chan string
 	inputVal  chan<- uint8
+	err       chan<- error
 }
 
 // distributorChans stores all the chans that the distributor goroutine will use.
 type distributorChans struct {
-	io distributorToIo
+	io        distributorToIo
+	control   <-chan controlRequest
+	events    chan<- Event
+	listening func() bool // Whether anyone is reading events, nil if someone always is
+	frames    chan frame
+	video     *videoStream               // nil if p.videoOut is empty
+	metrics   *gameMetrics               // nil if metrics are disabled
+	tracer    *tracer                    // nil if p.traceOut is empty
+	hashes    []chan uint64              // Hash of each worker's rows after every turn, nil if p.cycleLimit is 0
+	snapshots []chan [][]byte            // Copy of each worker's rows on SNAPSHOT, nil if there are no frames
+	newTicker func(time.Duration) ticker // Makes the ticker for the speed limit, nil for the clock
+}
+
+// externalChans stores the optional chans used to drive the game from outside gameOfLife.
+// A nil chan is never ready, so any of them may be left out.
+type externalChans struct {
+	key       <-chan rune
+	control   <-chan controlRequest
+	events    chan<- Event               // Closed by the distributor when the game ends
+	listening func() bool                // Whether anyone is reading events, so that turns aren't fetched for nobody. nil means always
+	frames    chan frame                 // Should have a buffer of 1. Closed by the distributor when the game ends
+	metrics   *gameMetrics               // Made with newGameMetrics(p.threads)
+	newTicker func(time.Duration) ticker // Makes the ticker for the speed limit, nil for the clock
 }
 
 // ioChans stores all the chans that the io goroutine will use.
@@ -101,24 +176,106 @@ const (
 	INPUT
 	WORK
 	IDLE
+	SNAPSHOT
 )
 
 // gameOfLife is the function called by the testing framework.
-// It makes some channels and starts relevant goroutines.
+// It returns an array of alive cells returned by the distributor,
+// or an error if p is invalid or a file couldn't be read or written.
+func gameOfLife(p golParams, key chan rune) ([]cell, error) {
+	return runGameOfLife(p, externalChans{key: key})
+}
+
+// gameOfLifeWithEvents runs the game like gameOfLife while sending every Event on events.
+// events must be read from until it is closed, which happens once the game has ended.
+// If p is invalid the game never starts, and events is closed straight away.
+func gameOfLifeWithEvents(p golParams, key chan rune, events chan<- Event) ([]cell, error) {
+	return runGameOfLife(p, externalChans{key: key, events: events})
+}
+
+// validateParams reports the first problem with p that would stop the game from running.
+func validateParams(p golParams) error {
+	switch {
+	case p.imageWidth <= 0 || p.imageHeight <= 0:
+		return fmt.Errorf("image size must be positive, not %dx%d", p.imageWidth, p.imageHeight)
+	case p.threads <= 0:
+		return fmt.Errorf("threads must be positive, not %d", p.threads)
+	case p.threads > p.imageHeight:
+		return fmt.Errorf("threads (%d) must be no more than the image height (%d)", p.threads, p.imageHeight)
+	case p.turns < 0:
+		return fmt.Errorf("turns must not be negative, not %d", p.turns)
+	case p.history < 0:
+		return fmt.Errorf("history must not be negative, not %d", p.history)
+	case p.threshold < 0 || p.threshold > 255:
+		return fmt.Errorf("threshold must be between 0 and 255, not %d", p.threshold)
+	case p.scale < 0 || p.gifEvery < 0 || p.videoEvery < 0:
+		return errors.New("scale, gif and video frame intervals must not be negative")
+	case p.cycleLimit < 0:
+		return fmt.Errorf("cycle limit must not be negative, not %d", p.cycleLimit)
+	}
+	if _, ok := outputFormats[p.outputFormat]; !ok && p.outputFormat != "" {
+		return fmt.Errorf("unknown output format %q", p.outputFormat)
+	}
+	if err := checkOutputFormat(p); err != nil {
+		return err
+	}
+	if _, ok := palettes[p.palette]; !ok && p.palette != "" {
+		return fmt.Errorf("unknown palette %q, choose from %s", p.palette, paletteNames())
+	}
+	if err := checkOutputTemplate(p.traceOut); err != nil {
+		return err
+	}
+	if err := checkOutputTemplate(p.censusOut); err != nil {
+		return err
+	}
+	return checkOutputTemplate(p.output)
+}
+
+// runGameOfLife makes some channels and starts relevant goroutines.
 // It places the created channels in the relevant structs.
-// It returns an array of alive cells returned by the distributor.
-func gameOfLife(p golParams, key chan rune) []cell {
+// It returns an array of alive cells returned by the distributor, or the error that stopped the game.
+// If the game can't start, ext.events and ext.frames are closed before returning, as the distributor would have.
+func runGameOfLife(p golParams, ext externalChans) ([]cell, error) {
+	fail := func(err error) ([]cell, error) {
+		if ext.events != nil {
+			close(ext.events)
+		}
+		if ext.frames != nil {
+			close(ext.frames)
+		}
+		return nil, err
+	}
+	if err := validateParams(p); err != nil {
+		return fail(err)
+	}
+
 	var dChans distributorChans
 	var ioChans ioChans
 
+	dChans.control = ext.control
+	dChans.events = ext.events
+	dChans.listening = ext.listening
+	dChans.newTicker = ext.newTicker
+	dChans.frames = ext.frames
+	dChans.metrics = ext.metrics
+	if ext.metrics != nil && len(ext.metrics.workers) != p.threads {
+		return fail(fmt.Errorf("metrics were made for %d workers but the game has %d", len(ext.metrics.workers), p.threads))
+	}
+	if p.traceOut != "" {
+		dChans.tracer = newTracer(p.threads)
+	}
+	if p.videoOut != "" {
+		video, err := openVideo(p)
+		if err != nil {
+			return fail(err)
+		}
+		dChans.video = video
+	}
+
 	ioCommand := make(chan ioCommand)
 	dChans.io.command = ioCommand
 	ioChans.distributor.command = ioCommand
 
-	ioIdle := make(chan bool)
-	dChans.io.idle = ioIdle
-	ioChans.distributor.idle = ioIdle
-
 	ioFilename := make(chan string)
 	dChans.io.filename = ioFilename
 	ioChans.distributor.filename = ioFilename
@@ -131,7 +288,11 @@ func gameOfLife(p golParams, key chan rune) []cell {
 	dChans.io.outputVal = outputVal
 	ioChans.distributor.outputVal = outputVal
 
-	aliveCells := make(chan []cell)
+	ioErr := make(chan error)
+	dChans.io.err = ioErr
+	ioChans.distributor.err = ioErr
+
+	result := make(chan gameResult)
 
 	workerChans := make([][]chan byte, p.threads)
 	comChans := make([]chan workerComs, p.threads)
@@ -143,6 +304,15 @@ func gameOfLife(p golParams, key chan rune) []cell {
 		comChans[i] = make(chan workerComs)
 	}
 
+	var bounds [][]int
+	if p.cycleLimit > 0 {
+		bounds = findBounds(p)
+		dChans.hashes = make([]chan uint64, p.threads)
+	}
+
+	// The workers and io, which return once the distributor is done with them
+	var running sync.WaitGroup
+
 	remainder := p.imageHeight % p.threads
 	for i := 0; i < p.threads; i++ {
 
@@ -159,20 +329,49 @@ func gameOfLife(p golParams, key chan rune) []cell {
 		} else {
 			offset = 2
 		}
-		go worker(in, out, workerChans[i][WORLD], (p.imageHeight/p.threads + offset), p.imageWidth, comChans[i])
+		var z *workerHash
+		if dChans.hashes != nil {
+			dChans.hashes[i] = make(chan uint64, 1)
+			z = &workerHash{top: bounds[i][0], hashes: dChans.hashes[i]}
+		}
+		var snap chan [][]byte
+		if dChans.frames != nil {
+			snap = make(chan [][]byte, 1)
+			dChans.snapshots = append(dChans.snapshots, snap)
+		}
+		i := i
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			worker(in, out, workerChans[i][WORLD], (p.imageHeight/p.threads + offset), p.imageWidth, comChans[i], ext.metrics.worker(i), dChans.tracer.worker(i), z, snap)
+		}()
 
 	}
 
-	go distributor(p, dChans, aliveCells, workerChans, key, comChans)
-	go pgmIo(p, ioChans)
-
-	alive := <-aliveCells
-	return alive
+	go distributor(p, dChans, result, workerChans, ext.key, comChans)
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		pgmIo(p, ioChans)
+	}()
+
+	// Wait for the workers and io to return too, so that nothing is left running once the game is over
+	r := <-result
+	running.Wait()
+	return r.alive, r.err
 }
 
 // main is the function called when starting Game of Life with 'make gol'
 // Do not edit until Stage 2.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "scale" {
+		// The scaling study subcommand, which runs games without a terminal and writes its results to files
+		if err := runScaling(os.Args[2:], os.Stderr); err != nil && err != flag.ErrHelp {
+			exitWithError(err)
+		}
+		return
+	}
+
 	var params golParams
 
 	flag.IntVar(
@@ -185,22 +384,227 @@ func main() {
 		&params.imageWidth,
 		"w",
 		512,
-		"Specify the width of the image. Defaults to 512.")
+		"Specify the width of the image. Defaults to 512, or the width of a pbm/pgm -pattern or -input.")
 
 	flag.IntVar(
 		&params.imageHeight,
 		"h",
 		512,
-		"Specify the height of the image. Defaults to 512.")
+		"Specify the height of the image. Defaults to 512, or the height of a pbm/pgm -pattern or -input.")
+
+	flag.IntVar(
+		&params.history,
+		"history",
+		0,
+		"Keep this many turns for rewinding with , and . while paused. Defaults to 0, which disables it.")
+
+	flag.StringVar(
+		&params.pattern,
+		"pattern",
+		"",
+		"Start from this file in images/ instead of WxH.pgm. Patterns (rle, cells, Life 1.05/1.06, macrocell) are placed in the middle of the board.")
+
+	flag.StringVar(
+		&params.input,
+		"input",
+		"",
+		"Start from this file instead of one in images/, or from stdin if it is -. Takes priority over -pattern.")
+
+	flag.StringVar(
+		&params.output,
+		"output",
+		defaultOutput,
+		"Where to write output images, or - for stdout. {turn}, {turns}, {width}, {height}, {rule} and {time} are filled in, "+
+			"and the extension of -format is added if there isn't one.")
+
+	flag.IntVar(
+		&params.threshold,
+		"threshold",
+		0,
+		"Pixels of pgm images brighter than this (0-255) start alive. Defaults to 0. Black pixels of pbm images are always alive.")
+
+	flag.StringVar(
+		&params.outputFormat,
+		"format",
+		"",
+		"Format of output images: pgm, png, rle, cells, life105, life106 or mc. "+
+			"Defaults to the one given by the extension of -output, or pgm if it has none.")
+
+	flag.IntVar(
+		&params.gifEvery,
+		"gif",
+		0,
+		"Write an animated gif of every Nth turn to out/ at the end of the run. Defaults to 0, which disables it.")
+
+	flag.IntVar(
+		&params.scale,
+		"scale",
+		1,
+		"Draw each cell of png, gif and video images as a square this many pixels wide. Defaults to 1.")
+
+	flag.StringVar(
+		&params.palette,
+		"palette",
+		"mono",
+		"Colours of png and gif images: "+paletteNames()+". Defaults to mono.")
+
+	flag.StringVar(
+		&params.videoOut,
+		"video",
+		"",
+		"Stream frames to this file, or to stdout if it is -, for piping into a video encoder. Disabled by default.")
+
+	flag.StringVar(
+		&params.videoFormat,
+		"video-format",
+		"y4m",
+		"Format of the -video stream: y4m (YUV4MPEG2, greyscale) or raw (8-bit greyscale frames, no header). Defaults to y4m.")
+
+	flag.IntVar(
+		&params.videoEvery,
+		"video-every",
+		1,
+		"Write every Nth turn to the -video stream. Defaults to 1.")
+
+	flag.StringVar(
+		&params.traceOut,
+		"trace-out",
+		"",
+		"Write a Chrome trace of how long each worker spent computing, swapping halos and waiting in every turn to this file, "+
+			"or to stdout if it is -, and print a summary. Placeholders are filled in as for -output. Disabled by default.")
+
+	flag.StringVar(
+		&params.censusOut,
+		"census",
+		"",
+		"Write a census of the still lifes, oscillators and spaceships in the final world, named by apgcode, to this "+
+			"CSV file, or to stdout if it is -, and print it. Placeholders are filled in as for -output. Disabled by default.")
+
+	flag.IntVar(
+		&params.cycleLimit,
+		"cycles",
+		0,
+		"Look for the world becoming a still life or oscillating with a period of up to this many turns, and print "+
+			"the turn it started on and the period. Worlds are compared by hash, and a repeated hash is checked against "+
+			"the world it was seen with before it is reported. Disabled by default.")
+
+	flag.BoolVar(
+		&params.cycleStop,
+		"cycle-stop",
+		false,
+		"End the game as soon as -cycles finds a still life or oscillation.")
+
+	httpAddr := flag.String(
+		"http",
+		"",
+		"Serve the HTTP control API on the given address, e.g. :8080. Disabled by default.")
+
+	metricsAddr := flag.String(
+		"metrics",
+		"",
+		"Serve Prometheus metrics at /metrics on the given address, e.g. :9090. Disabled by default.")
+
+	render := flag.Bool(
+		"render",
+		false,
+		"Draw the board live in the terminal. Arrow keys pan, + and - zoom, g toggles braille and half blocks. "+
+			"The game's messages are left out while it is on, as its status line shows the same. Disabled by default.")
 
 	flag.Parse()
 
 	params.turns = 1000000000
 
+	sizeSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "w" || f.Name == "h" {
+			sizeSet = true
+		}
+	})
+	if (params.pattern != "" || params.input != "") && !sizeSet {
+		var err error
+		if params, err = inferImageSize(params); err != nil {
+			exitWithError(err)
+		}
+	}
+	if err := validateParams(params); err != nil {
+		exitWithError(err)
+	}
+	if err := checkPaths(params); err != nil {
+		exitWithError(err)
+	}
+
+	if params.output == "-" || params.videoOut == "-" || params.traceOut == "-" || params.censusOut == "-" {
+		// Anything printed would corrupt the output, so it goes to stderr instead
+		params.messageOut = os.Stderr
+	}
+	if *render {
+		// Anything printed would be drawn over the board
+		params.messageOut = ioutil.Discard
+	}
+
 	key := make(chan rune)
+	control := make(chan controlRequest)
+	done := make(chan struct{})
+	var events chan Event
+	var listening func() bool
+
+	if *httpAddr != "" {
+		// Reporting flipped cells costs a world fetch per turn, so it is only done while someone is subscribed
+		events = make(chan Event, eventBufferSize)
+		broker := newEventBroker()
+		listening = broker.listening
+		go broker.run(events)
+
+		server := &http.Server{Addr: *httpAddr, Handler: newAPIServer(params, control, broker, done)}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				fmt.Fprintln(os.Stderr, "HTTP server:", err)
+			}
+		}()
+		defer server.Close()
+	}
 
-	startControlServer(params)
+	var metrics *gameMetrics
+	if *metricsAddr != "" {
+		metrics = newGameMetrics(params.threads)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", newMetricsHandler(metrics))
+		server := &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				fmt.Fprintln(os.Stderr, "Metrics server:", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	var frames chan frame
+	if *render {
+		frames = make(chan frame, 1)
+	}
+
+	if err := startControlServer(params); err != nil {
+		exitWithError(err)
+	}
 	go getKeyboardCommand(key)
-	gameOfLife(params, key)
+	if frames != nil {
+		go func() {
+			// The distributor never waits for frames to be drawn, so the game carries on without the renderer
+			if err := renderer(params, frames); err != nil {
+				fmt.Fprintln(os.Stderr, "Renderer:", err)
+			}
+		}()
+	}
+	_, err := runGameOfLife(params, externalChans{key: key, control: control, events: events, listening: listening, frames: frames, metrics: metrics})
+	close(done)
 	StopControlServer()
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+// exitWithError reports an error that stopped the program from running and exits with a failure status.
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(1)
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
-	"os"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test(t *testing.T) {
@@ -191,6 +196,376 @@ func Test(t *testing.T) {
 				{x: 14, y: 15},
 			},
 		}},
+
+		// Rectangular boards, with thread counts that don't divide the height
+		{"1024x64x3-0", args{
+			p: golParams{
+				turns:       0,
+				threads:     3,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 1022, y: 0},
+				{x: 1023, y: 0},
+				{x: 101, y: 5},
+				{x: 102, y: 6},
+				{x: 100, y: 7},
+				{x: 101, y: 7},
+				{x: 102, y: 7},
+				{x: 500, y: 30},
+				{x: 501, y: 30},
+				{x: 502, y: 30},
+				{x: 0, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 1023, y: 32},
+				{x: 1023, y: 62},
+				{x: 0, y: 63},
+			},
+		}},
+
+		{"1024x64x3-1", args{
+			p: golParams{
+				turns:       1,
+				threads:     3,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 1023, y: 0},
+				{x: 1023, y: 1},
+				{x: 100, y: 6},
+				{x: 102, y: 6},
+				{x: 101, y: 7},
+				{x: 102, y: 7},
+				{x: 101, y: 8},
+				{x: 501, y: 29},
+				{x: 501, y: 30},
+				{x: 0, y: 31},
+				{x: 501, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 1023, y: 32},
+				{x: 0, y: 63},
+				{x: 1022, y: 63},
+			},
+		}},
+
+		{"1024x64x5-1", args{
+			p: golParams{
+				turns:       1,
+				threads:     5,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 1023, y: 0},
+				{x: 1023, y: 1},
+				{x: 100, y: 6},
+				{x: 102, y: 6},
+				{x: 101, y: 7},
+				{x: 102, y: 7},
+				{x: 101, y: 8},
+				{x: 501, y: 29},
+				{x: 501, y: 30},
+				{x: 0, y: 31},
+				{x: 501, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 1023, y: 32},
+				{x: 0, y: 63},
+				{x: 1022, y: 63},
+			},
+		}},
+
+		{"1024x64x7-1", args{
+			p: golParams{
+				turns:       1,
+				threads:     7,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 1023, y: 0},
+				{x: 1023, y: 1},
+				{x: 100, y: 6},
+				{x: 102, y: 6},
+				{x: 101, y: 7},
+				{x: 102, y: 7},
+				{x: 101, y: 8},
+				{x: 501, y: 29},
+				{x: 501, y: 30},
+				{x: 0, y: 31},
+				{x: 501, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 1023, y: 32},
+				{x: 0, y: 63},
+				{x: 1022, y: 63},
+			},
+		}},
+
+		{"1024x64x3-100", args{
+			p: golParams{
+				turns:       100,
+				threads:     3,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 24, y: 23},
+				{x: 25, y: 24},
+				{x: 23, y: 25},
+				{x: 24, y: 25},
+				{x: 25, y: 25},
+				{x: 126, y: 30},
+				{x: 500, y: 30},
+				{x: 501, y: 30},
+				{x: 502, y: 30},
+				{x: 0, y: 31},
+				{x: 127, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 125, y: 32},
+				{x: 126, y: 32},
+				{x: 127, y: 32},
+				{x: 1023, y: 32},
+			},
+		}},
+
+		{"1024x64x5-100", args{
+			p: golParams{
+				turns:       100,
+				threads:     5,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 24, y: 23},
+				{x: 25, y: 24},
+				{x: 23, y: 25},
+				{x: 24, y: 25},
+				{x: 25, y: 25},
+				{x: 126, y: 30},
+				{x: 500, y: 30},
+				{x: 501, y: 30},
+				{x: 502, y: 30},
+				{x: 0, y: 31},
+				{x: 127, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 125, y: 32},
+				{x: 126, y: 32},
+				{x: 127, y: 32},
+				{x: 1023, y: 32},
+			},
+		}},
+
+		{"1024x64x7-100", args{
+			p: golParams{
+				turns:       100,
+				threads:     7,
+				imageWidth:  1024,
+				imageHeight: 64,
+			},
+			expectedAlive: []cell{
+				{x: 24, y: 23},
+				{x: 25, y: 24},
+				{x: 23, y: 25},
+				{x: 24, y: 25},
+				{x: 25, y: 25},
+				{x: 126, y: 30},
+				{x: 500, y: 30},
+				{x: 501, y: 30},
+				{x: 502, y: 30},
+				{x: 0, y: 31},
+				{x: 127, y: 31},
+				{x: 1023, y: 31},
+				{x: 0, y: 32},
+				{x: 125, y: 32},
+				{x: 126, y: 32},
+				{x: 127, y: 32},
+				{x: 1023, y: 32},
+			},
+		}},
+
+		{"7x300x3-0", args{
+			p: golParams{
+				turns:       0,
+				threads:     3,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 5, y: 0},
+				{x: 6, y: 0},
+				{x: 0, y: 10},
+				{x: 6, y: 10},
+				{x: 0, y: 11},
+				{x: 6, y: 11},
+				{x: 2, y: 150},
+				{x: 3, y: 150},
+				{x: 4, y: 150},
+				{x: 6, y: 298},
+				{x: 0, y: 299},
+			},
+		}},
+
+		{"7x300x3-1", args{
+			p: golParams{
+				turns:       1,
+				threads:     3,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 6, y: 0},
+				{x: 6, y: 1},
+				{x: 0, y: 10},
+				{x: 6, y: 10},
+				{x: 0, y: 11},
+				{x: 6, y: 11},
+				{x: 3, y: 149},
+				{x: 3, y: 150},
+				{x: 3, y: 151},
+				{x: 0, y: 299},
+				{x: 5, y: 299},
+			},
+		}},
+
+		{"7x300x7-1", args{
+			p: golParams{
+				turns:       1,
+				threads:     7,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 6, y: 0},
+				{x: 6, y: 1},
+				{x: 0, y: 10},
+				{x: 6, y: 10},
+				{x: 0, y: 11},
+				{x: 6, y: 11},
+				{x: 3, y: 149},
+				{x: 3, y: 150},
+				{x: 3, y: 151},
+				{x: 0, y: 299},
+				{x: 5, y: 299},
+			},
+		}},
+
+		{"7x300x13-1", args{
+			p: golParams{
+				turns:       1,
+				threads:     13,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 0, y: 0},
+				{x: 6, y: 0},
+				{x: 6, y: 1},
+				{x: 0, y: 10},
+				{x: 6, y: 10},
+				{x: 0, y: 11},
+				{x: 6, y: 11},
+				{x: 3, y: 149},
+				{x: 3, y: 150},
+				{x: 3, y: 151},
+				{x: 0, y: 299},
+				{x: 5, y: 299},
+			},
+		}},
+
+		{"7x300x3-100", args{
+			p: golParams{
+				turns:       100,
+				threads:     3,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 2, y: 2},
+				{x: 3, y: 2},
+				{x: 2, y: 3},
+				{x: 3, y: 3},
+				{x: 4, y: 7},
+				{x: 5, y: 7},
+				{x: 3, y: 8},
+				{x: 6, y: 8},
+				{x: 4, y: 9},
+				{x: 5, y: 9},
+				{x: 3, y: 14},
+				{x: 3, y: 15},
+				{x: 3, y: 16},
+				{x: 2, y: 150},
+				{x: 3, y: 150},
+				{x: 4, y: 150},
+			},
+		}},
+
+		{"7x300x7-100", args{
+			p: golParams{
+				turns:       100,
+				threads:     7,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 2, y: 2},
+				{x: 3, y: 2},
+				{x: 2, y: 3},
+				{x: 3, y: 3},
+				{x: 4, y: 7},
+				{x: 5, y: 7},
+				{x: 3, y: 8},
+				{x: 6, y: 8},
+				{x: 4, y: 9},
+				{x: 5, y: 9},
+				{x: 3, y: 14},
+				{x: 3, y: 15},
+				{x: 3, y: 16},
+				{x: 2, y: 150},
+				{x: 3, y: 150},
+				{x: 4, y: 150},
+			},
+		}},
+
+		{"7x300x13-100", args{
+			p: golParams{
+				turns:       100,
+				threads:     13,
+				imageWidth:  7,
+				imageHeight: 300,
+			},
+			expectedAlive: []cell{
+				{x: 2, y: 2},
+				{x: 3, y: 2},
+				{x: 2, y: 3},
+				{x: 3, y: 3},
+				{x: 4, y: 7},
+				{x: 5, y: 7},
+				{x: 3, y: 8},
+				{x: 6, y: 8},
+				{x: 4, y: 9},
+				{x: 5, y: 9},
+				{x: 3, y: 14},
+				{x: 3, y: 15},
+				{x: 3, y: 16},
+				{x: 2, y: 150},
+				{x: 3, y: 150},
+				{x: 4, y: 150},
+			},
+		}},
 		// Special test to be used to generate traces - not a real test
 		//{"trace", args{
 		//	p: golParams{
@@ -201,9 +576,15 @@ func Test(t *testing.T) {
 		//	},
 		//}},
 	}
+	// Write the images somewhere else, so they can't replace the references in out/ that TestGolden reads
+	dir, cleanup := tempDir(t)
+	defer cleanup()
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			alive := gameOfLife(test.args.p, nil)
+			p := test.args.p
+			p.output = filepath.Join(dir, "{width}x{height}-{turns}")
+			alive, err := gameOfLife(p, nil)
+			assert.NoError(t, err)
 			//fmt.Println("Ran test:", test.name)
 			if test.name != "trace" {
 				assert.ElementsMatch(t, alive, test.args.expectedAlive)
@@ -212,6 +593,42 @@ func Test(t *testing.T) {
 	}
 }
 
+// TestRectangularOutput checks that output images of rectangular boards are the right way round.
+func TestRectangularOutput(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 1, threads: 7, imageWidth: 7, imageHeight: 300, output: filepath.Join(dir, "{width}x{height}")}
+	alive, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "7x300.pgm"))
+	require.NoError(t, err)
+	_, world, err := parseNetpbm(bytes.NewReader(data), 0)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, alive, aliveCells(world))
+}
+
+// TestGoroutinesReturn checks that nothing the game started is still running once gameOfLife has returned.
+func TestGoroutinesReturn(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	before := runtime.NumGoroutine()
+	p := golParams{turns: 10, threads: 8, imageWidth: 64, imageHeight: 64, output: filepath.Join(dir, "board"), quiet: true}
+	_, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+	p.input = filepath.Join(dir, "missing.pgm")
+	_, err = gameOfLife(p, nil)
+	require.Error(t, err)
+
+	// A goroutine that has just said it is done can take a moment to be gone
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	n := runtime.NumGoroutine()
+	assert.True(t, n <= before, "%d goroutines before the games and %d after", before, n)
+}
+
 const benchLength = 1000
 
 func Benchmark(b *testing.B) {
@@ -339,11 +756,16 @@ func Benchmark(b *testing.B) {
 				imageHeight: 512,
 			}},
 	}
+	dir, cleanup := tempDir(b)
+	defer cleanup()
 	for _, bm := range benchmarks {
-		os.Stdout = nil // Disable all program output apart from benchmark results
+		bm.p.quiet = true // Disable all program output apart from benchmark results
+		bm.p.output = filepath.Join(dir, "{width}x{height}-{turns}")
 		b.Run(bm.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				gameOfLife(bm.p, nil)
+				if _, err := gameOfLife(bm.p, nil); err != nil {
+					b.Fatal(err)
+				}
 				//fmt.Println("Ran bench:", bm.name)
 			}
 		})
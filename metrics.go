@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotBuckets are the upper bounds in seconds of the histogram of image write times.
+var snapshotBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// workerMetrics is how a single worker has spent its time, in nanoseconds.
+// A nil *workerMetrics records nothing, so workers don't need to check whether metrics are enabled.
+type workerMetrics struct {
+	compute  int64 // Computing turns
+	haloWait int64 // Swapping halo rows with its neighbours, which is mostly waiting for them
+}
+
+// record adds the time a turn took to swap halos and to compute.
+func (m *workerMetrics) record(halo, compute time.Duration) {
+	if m != nil {
+		atomic.AddInt64(&m.haloWait, int64(halo))
+		atomic.AddInt64(&m.compute, int64(compute))
+	}
+}
+
+// histogram counts observations in cumulative buckets, as Prometheus expects.
+type histogram struct {
+	mutex   sync.Mutex
+	bounds  []float64
+	buckets []uint64 // Observations no bigger than each bound
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// gameMetrics is what the distributor and workers record while a game runs, for the -metrics endpoint.
+// A nil *gameMetrics records nothing.
+type gameMetrics struct {
+	turn           int64  // Turns completed
+	alive          int64  // Alive cells when last counted
+	rate           uint64 // Generations per second since the previous sample, as float64 bits
+	commandBlocked int64  // Nanoseconds the distributor waited for workers to take commands
+	worldBlocked   int64  // Nanoseconds the distributor spent sending or receiving the world to or from workers
+	snapshots      *histogram
+	workers        []workerMetrics
+
+	// Only used by the distributor
+	rateTurn int
+	rateTime time.Time
+}
+
+// newGameMetrics makes metrics for a game with the given number of workers.
+func newGameMetrics(threads int) *gameMetrics {
+	return &gameMetrics{snapshots: newHistogram(snapshotBuckets), workers: make([]workerMetrics, threads)}
+}
+
+// worker returns the metrics of the ith worker, or nil if metrics are disabled.
+func (m *gameMetrics) worker(i int) *workerMetrics {
+	if m == nil {
+		return nil
+	}
+	return &m.workers[i]
+}
+
+func (m *gameMetrics) setTurn(turn int) {
+	if m != nil {
+		atomic.StoreInt64(&m.turn, int64(turn))
+	}
+}
+
+func (m *gameMetrics) setAlive(alive int) {
+	if m != nil {
+		atomic.StoreInt64(&m.alive, int64(alive))
+	}
+}
+
+// sampleRate updates the generations per second with the turns completed since the previous sample.
+// If running is false the game isn't computing turns, so the rate is zero.
+func (m *gameMetrics) sampleRate(turn int, running bool) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	rate := 0.0
+	if running && !m.rateTime.IsZero() {
+		if elapsed := now.Sub(m.rateTime).Seconds(); elapsed > 0 {
+			rate = float64(turn-m.rateTurn) / elapsed
+		}
+	}
+	atomic.StoreUint64(&m.rate, math.Float64bits(rate))
+	m.rateTurn, m.rateTime = turn, now
+}
+
+// now returns the current time, or nothing if metrics are disabled.
+func (m *gameMetrics) now() time.Time {
+	if m == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (m *gameMetrics) addCommandBlocked(start time.Time) {
+	if m != nil {
+		atomic.AddInt64(&m.commandBlocked, int64(time.Since(start)))
+	}
+}
+
+func (m *gameMetrics) addWorldBlocked(start time.Time) {
+	if m != nil {
+		atomic.AddInt64(&m.worldBlocked, int64(time.Since(start)))
+	}
+}
+
+func (m *gameMetrics) observeSnapshot(start time.Time) {
+	if m != nil {
+		m.snapshots.observe(time.Since(start).Seconds())
+	}
+}
+
+// seconds converts a nanosecond counter to seconds.
+func seconds(nanoseconds *int64) float64 {
+	return time.Duration(atomic.LoadInt64(nanoseconds)).Seconds()
+}
+
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeMetrics writes the metrics in the Prometheus text exposition format.
+func (m *gameMetrics) writeMetrics(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	family := func(name, kind, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	family("gol_turn", "gauge", "Turns completed.")
+	fmt.Fprintf(b, "gol_turn %d\n", atomic.LoadInt64(&m.turn))
+	family("gol_generations_per_second", "gauge", "Turns completed per second, over the last few seconds.")
+	fmt.Fprintf(b, "gol_generations_per_second %s\n", formatMetric(math.Float64frombits(atomic.LoadUint64(&m.rate))))
+	family("gol_alive_cells", "gauge", "Alive cells when last counted.")
+	fmt.Fprintf(b, "gol_alive_cells %d\n", atomic.LoadInt64(&m.alive))
+
+	family("gol_worker_compute_seconds_total", "counter", "Time each worker has spent computing turns.")
+	for i := range m.workers {
+		fmt.Fprintf(b, "gol_worker_compute_seconds_total{worker=\"%d\"} %s\n", i, formatMetric(seconds(&m.workers[i].compute)))
+	}
+	family("gol_worker_halo_wait_seconds_total", "counter", "Time each worker has spent swapping halo rows with its neighbours.")
+	for i := range m.workers {
+		fmt.Fprintf(b, "gol_worker_halo_wait_seconds_total{worker=\"%d\"} %s\n", i, formatMetric(seconds(&m.workers[i].haloWait)))
+	}
+
+	family("gol_channel_blocked_seconds_total", "counter", "Time the distributor has spent blocked on worker channels.")
+	fmt.Fprintf(b, "gol_channel_blocked_seconds_total{chan=\"command\"} %s\n", formatMetric(seconds(&m.commandBlocked)))
+	fmt.Fprintf(b, "gol_channel_blocked_seconds_total{chan=\"world\"} %s\n", formatMetric(seconds(&m.worldBlocked)))
+
+	family("gol_snapshot_write_seconds", "histogram", "Time taken to fetch the world and write it as an image.")
+	m.snapshots.mutex.Lock()
+	for i, bound := range m.snapshots.bounds {
+		fmt.Fprintf(b, "gol_snapshot_write_seconds_bucket{le=\"%s\"} %d\n", formatMetric(bound), m.snapshots.buckets[i])
+	}
+	fmt.Fprintf(b, "gol_snapshot_write_seconds_bucket{le=\"+Inf\"} %d\n", m.snapshots.count)
+	fmt.Fprintf(b, "gol_snapshot_write_seconds_sum %s\n", formatMetric(m.snapshots.sum))
+	fmt.Fprintf(b, "gol_snapshot_write_seconds_count %d\n", m.snapshots.count)
+	m.snapshots.mutex.Unlock()
+
+	return b.Flush()
+}
+
+// newMetricsHandler serves the metrics for Prometheus to scrape.
+func newMetricsHandler(m *gameMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.writeMetrics(w)
+	})
+}
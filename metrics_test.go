@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics fetches the metrics from h and returns each sample by its name and labels, such as
+// gol_worker_compute_seconds_total{worker="0"}.
+func scrapeMetrics(t *testing.T, h http.Handler) map[string]float64 {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	samples := map[string]float64{}
+	families := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			require.Len(t, fields, 4, line)
+			families[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		require.True(t, i > 0, line)
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		require.NoError(t, err, line)
+		name := line[:i]
+		samples[name] = v
+
+		// Every sample belongs to a family declared before it
+		family := name
+		if j := strings.Index(family, "{"); j >= 0 {
+			family = family[:j]
+		}
+		if families[family] == "" {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				family = strings.TrimSuffix(family, suffix)
+			}
+		}
+		assert.NotEmpty(t, families[family], "%s has no TYPE line", name)
+	}
+	return samples
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(2)
+	assert.Equal(t, []uint64{1, 2}, h.buckets)
+	assert.Equal(t, uint64(3), h.count)
+	assert.InDelta(t, 2.55, h.sum, 1e-12)
+}
+
+func TestSampleRate(t *testing.T) {
+	var m *gameMetrics
+	m.sampleRate(10, true) // Disabled metrics record nothing
+
+	m = newGameMetrics(1)
+	rate := func() float64 {
+		return scrapeMetrics(t, newMetricsHandler(m))["gol_generations_per_second"]
+	}
+	m.sampleRate(0, true)
+	assert.Equal(t, 0.0, rate(), "no previous sample")
+	m.rateTime = m.rateTime.Add(-2 * time.Second)
+	m.sampleRate(100, true)
+	assert.InDelta(t, 50, rate(), 1)
+	m.sampleRate(100, false)
+	assert.Equal(t, 0.0, rate(), "paused")
+}
+
+func TestMetricsHandler(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 100, threads: 4, imageWidth: 16, imageHeight: 16, output: filepath.Join(dir, "board")}
+	m := newGameMetrics(p.threads)
+	h := newMetricsHandler(m)
+
+	before := scrapeMetrics(t, h)
+	assert.Equal(t, 0.0, before["gol_turn"])
+	assert.Equal(t, 0.0, before[`gol_snapshot_write_seconds_count`])
+
+	alive, err := runGameOfLife(p, externalChans{metrics: m})
+	require.NoError(t, err)
+
+	samples := scrapeMetrics(t, h)
+	assert.Equal(t, 100.0, samples["gol_turn"])
+	assert.Equal(t, float64(len(alive)), samples["gol_alive_cells"])
+	assert.Equal(t, 0.0, samples["gol_generations_per_second"], "the game is over")
+	for i := 0; i < p.threads; i++ {
+		worker := `{worker="` + strconv.Itoa(i) + `"}`
+		assert.True(t, samples["gol_worker_compute_seconds_total"+worker] > 0, worker)
+		assert.Contains(t, samples, "gol_worker_halo_wait_seconds_total"+worker)
+	}
+	assert.NotContains(t, samples, `gol_worker_compute_seconds_total{worker="4"}`)
+	assert.True(t, samples[`gol_channel_blocked_seconds_total{chan="command"}`] > 0)
+	assert.True(t, samples[`gol_channel_blocked_seconds_total{chan="world"}`] > 0)
+	assert.Equal(t, 1.0, samples[`gol_snapshot_write_seconds_bucket{le="+Inf"}`])
+	assert.Equal(t, 1.0, samples["gol_snapshot_write_seconds_count"])
+	assert.True(t, samples["gol_snapshot_write_seconds_sum"] > 0)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// TestMetricsWhileRunning scrapes the metrics of a game that is still running, which -race checks for data races.
+func TestMetricsWhileRunning(t *testing.T) {
+	p := golParams{turns: 1000000000, threads: 3, imageWidth: 64, imageHeight: 64}
+	m := newGameMetrics(p.threads)
+	h := newMetricsHandler(m)
+	key, _, finalAlive := startKeyTest(t, p, externalChans{metrics: m})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for scrapeMetrics(t, h)["gol_turn"] < 10 {
+		require.True(t, time.Now().Before(deadline), "the game never got going")
+		time.Sleep(time.Millisecond)
+	}
+	key <- 'q'
+	<-finalAlive
+	assert.True(t, scrapeMetrics(t, h)["gol_turn"] >= 10)
+}
+
+func TestMetricsWorkerMismatch(t *testing.T) {
+	p := golParams{turns: 1, threads: 4, imageWidth: 16, imageHeight: 16}
+	_, err := runGameOfLife(p, externalChans{metrics: newGameMetrics(2)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxNetpbmSize is the largest width or height accepted from a Netpbm header.
+const maxNetpbmSize = 1 << 16
+
+// netpbmHeader is the start of a PBM (P1, P4) or PGM (P2, P5) image.
+type netpbmHeader struct {
+	magic         string
+	width, height int
+	maxval        int // 1 for PBM images
+}
+
+// ascii reports whether the raster is written as decimal numbers rather than binary.
+func (h netpbmHeader) ascii() bool {
+	return h.magic == "P1" || h.magic == "P2"
+}
+
+// bitmap reports whether the image is a PBM, where 1 means black and every other pixel is white.
+func (h netpbmHeader) bitmap() bool {
+	return h.magic == "P1" || h.magic == "P4"
+}
+
+// isNetpbmSpace reports whether c separates tokens in a Netpbm file.
+func isNetpbmSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// skipNetpbmSpace skips whitespace and comments, which run from '#' to the end of the line.
+func skipNetpbmSpace(r *bufio.Reader) error {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '#':
+			if _, err := r.ReadBytes('\n'); err != nil {
+				return err
+			}
+		case !isNetpbmSpace(c):
+			return r.UnreadByte()
+		}
+	}
+}
+
+// readNetpbmNumber reads a decimal number no bigger than max, after any whitespace and comments.
+func readNetpbmNumber(r *bufio.Reader, name string, max int) (int, error) {
+	if err := skipNetpbmSpace(r); err != nil {
+		return 0, fmt.Errorf("netpbm: missing %s", name)
+	}
+	n, digits := 0, 0
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		if c < '0' || c > '9' {
+			if err := r.UnreadByte(); err != nil {
+				return 0, err
+			}
+			break
+		}
+		n = n*10 + int(c-'0')
+		digits++
+		if n > max {
+			return 0, fmt.Errorf("netpbm: %s is bigger than %d", name, max)
+		}
+	}
+	if digits == 0 {
+		return 0, fmt.Errorf("netpbm: %s is not a number", name)
+	}
+	return n, nil
+}
+
+// readNetpbmHeader reads the magic number, size and maxval of an image,
+// leaving r at the first byte of the raster.
+func readNetpbmHeader(r *bufio.Reader) (netpbmHeader, error) {
+	var h netpbmHeader
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return h, errors.New("netpbm: missing magic number")
+	}
+	h.magic = string(magic)
+	switch h.magic {
+	case "P1", "P2", "P4", "P5":
+	case "P3", "P6":
+		return h, fmt.Errorf("netpbm: %s colour images are not supported", h.magic)
+	default:
+		return h, fmt.Errorf("netpbm: %q is not a PBM or PGM magic number", h.magic)
+	}
+
+	var err error
+	if h.width, err = readNetpbmNumber(r, "width", maxNetpbmSize); err != nil {
+		return h, err
+	}
+	if h.height, err = readNetpbmNumber(r, "height", maxNetpbmSize); err != nil {
+		return h, err
+	}
+	if h.width == 0 || h.height == 0 {
+		return h, fmt.Errorf("netpbm: %dx%d image is empty", h.width, h.height)
+	}
+	h.maxval = 1
+	if !h.bitmap() {
+		if h.maxval, err = readNetpbmNumber(r, "maxval", 65535); err != nil {
+			return h, err
+		}
+		if h.maxval == 0 {
+			return h, errors.New("netpbm: maxval must be at least 1")
+		}
+	}
+
+	// Binary rasters start after exactly one whitespace character
+	if !h.ascii() {
+		c, err := r.ReadByte()
+		if err != nil || !isNetpbmSpace(c) {
+			return h, errors.New("netpbm: missing whitespace before the raster")
+		}
+	}
+	return h, nil
+}
+
+// readNetpbmRow reads one row of raw pixel values into row.
+func readNetpbmRow(r *bufio.Reader, h netpbmHeader, row []int, buf []byte) error {
+	switch {
+	case h.magic == "P1":
+		// Bits don't need to be separated by whitespace
+		for x := range row {
+			if err := skipNetpbmSpace(r); err != nil {
+				return err
+			}
+			c, _ := r.ReadByte()
+			if c != '0' && c != '1' {
+				return fmt.Errorf("netpbm: unexpected %q in bitmap", c)
+			}
+			row[x] = int(c - '0')
+		}
+	case h.magic == "P2":
+		for x := range row {
+			v, err := readNetpbmNumber(r, "pixel", h.maxval)
+			if err != nil {
+				return err
+			}
+			row[x] = v
+		}
+	case h.magic == "P4":
+		// Each row is padded to a whole number of bytes, with the first pixel in the top bit
+		if _, err := io.ReadFull(r, buf[:(len(row)+7)/8]); err != nil {
+			return err
+		}
+		for x := range row {
+			row[x] = int(buf[x/8]>>uint(7-x%8)) & 1
+		}
+	case h.maxval < 256:
+		if _, err := io.ReadFull(r, buf[:len(row)]); err != nil {
+			return err
+		}
+		for x := range row {
+			row[x] = int(buf[x])
+		}
+	default:
+		// 16-bit samples are big endian
+		if _, err := io.ReadFull(r, buf[:2*len(row)]); err != nil {
+			return err
+		}
+		for x := range row {
+			row[x] = int(buf[2*x])<<8 | int(buf[2*x+1])
+		}
+	}
+	for _, v := range row {
+		if v > h.maxval {
+			return fmt.Errorf("netpbm: pixel %d is bigger than maxval %d", v, h.maxval)
+		}
+	}
+	return nil
+}
+
+// parseNetpbm reads a PBM or PGM image as a world.
+// Black PBM pixels are alive, as are PGM pixels brighter than threshold once scaled to 0-255.
+func parseNetpbm(r io.Reader, threshold int) (netpbmHeader, [][]byte, error) {
+	br := bufio.NewReader(r)
+	h, err := readNetpbmHeader(br)
+	if err != nil {
+		return h, nil, err
+	}
+
+	// Rows are only made as they are read, so a truncated file can't claim a huge image
+	var world [][]byte
+	row := make([]int, h.width)
+	buf := make([]byte, 2*h.width)
+	for y := 0; y < h.height; y++ {
+		if err := readNetpbmRow(br, h, row, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return h, nil, fmt.Errorf("netpbm: image ends after %d of %d rows", y, h.height)
+			}
+			return h, nil, err
+		}
+		world = append(world, make([]byte, h.width))
+		for x, v := range row {
+			if h.bitmap() && v == 1 || !h.bitmap() && v*255/h.maxval > threshold {
+				world[y][x] = 0xFF
+			}
+		}
+	}
+	return h, world, nil
+}
+
+// inferImageSize sets the board size to the size of the input if it is a Netpbm image.
+// Other patterns, and anything on stdin, are placed on a board of the size already in p.
+func inferImageSize(p golParams) (golParams, error) {
+	path := inputPath(p)
+	if path == "-" {
+		return p, nil
+	}
+	data, err := readInput(path)
+	if err != nil {
+		return p, err
+	}
+	if detectFormat(path, data) != "pgm" {
+		return p, nil
+	}
+	h, err := readNetpbmHeader(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return p, fmt.Errorf("%s: %v", path, err)
+	}
+	p.imageWidth, p.imageHeight = h.width, h.height
+	return p, nil
+}
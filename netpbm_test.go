@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetpbm(t *testing.T) {
+	// Every image is 3x2 with the same cells alive
+	want := []cell{{1, 0}, {0, 1}, {2, 1}}
+	for name, data := range map[string]string{
+		"P5":            "P5\n3 2\n255\n\x00\xff\x00\xff\x00\xff",
+		"P5 comments":   "P5 # made by hand\n3 # wide\n#\n2\n255 \x00\xff\x00\xff\x00\xff",
+		"P5 whitespace": "P5 3 2 255\n\x00\x0a\x00\x20\x00\x09",
+		"P5 maxval 1":   "P5\n3 2\n1\n\x00\x01\x00\x01\x00\x01",
+		"P5 16-bit":     "P5\n3 2\n65535\n\x00\x00\xff\xff\x00\x00\x01\x01\x00\x00\x80\x00",
+		"P2":            "P2\n# ascii\n3 2\n15\n0 15 0\n8 0 9\n",
+		"P2 16-bit":     "P2 3 2 1000 0 1000 0 999 0 1000",
+		"P1":            "P1\n3 2\n0 1 0\n1 0 1\n",
+		"P1 packed":     "P1\n# no spaces\n3 2\n010\n1 # comment\n01",
+		"P4":            "P4\n3 2\n\x40\xa0",
+		"P4 trailing":   "P4\n3 2\n\x5f\xbf\x00",
+	} {
+		h, world, err := parseNetpbm(strings.NewReader(data), 0)
+		require.NoError(t, err, name)
+		assert.Equal(t, 3, h.width, name)
+		assert.Equal(t, 2, h.height, name)
+		assert.Equal(t, want, aliveCells(world), name)
+	}
+}
+
+func TestParseNetpbmThreshold(t *testing.T) {
+	data := "P2\n4 1\n1000\n0 200 500 1000\n"
+	for threshold, want := range map[int][]cell{
+		0:   {{1, 0}, {2, 0}, {3, 0}},
+		100: {{2, 0}, {3, 0}},
+		127: {{3, 0}},
+		254: {{3, 0}},
+		255: nil,
+	} {
+		_, world, err := parseNetpbm(strings.NewReader(data), threshold)
+		require.NoError(t, err)
+		assert.Equal(t, want, aliveCells(world), "threshold %d", threshold)
+	}
+}
+
+func TestParseNetpbmErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"empty":         "",
+		"magic":         "P7\n3 2\n255\n",
+		"colour":        "P6\n3 2\n255\n",
+		"no width":      "P5\n",
+		"bad width":     "P5\nx 2\n255\n",
+		"zero height":   "P5\n3 0\n255\n",
+		"huge":          "P5\n100000 2\n255\n",
+		"zero maxval":   "P5\n3 2\n0\n",
+		"big maxval":    "P5\n3 2\n65536\n",
+		"no raster gap": "P5\n3 2\n255",
+		"truncated":     "P5\n3 2\n255\n\x00\x00\x00\x00",
+		"truncated P4":  "P4\n3 2\n\x40",
+		"over maxval":   "P5\n3 2\n100\n\x00\x00\x00\x00\x00\x65",
+		"P2 over":       "P2\n3 2\n15\n0 0 0 0 0 16",
+		"P2 junk":       "P2\n3 2\n15\n0 0 0 0 0 x",
+		"P1 junk":       "P1\n3 2\n0 1 0 1 0 2",
+	} {
+		_, _, err := parseNetpbm(strings.NewReader(data), 0)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestNetpbmRoundTrip(t *testing.T) {
+	p := golParams{imageWidth: 5, imageHeight: 3}
+	world := emptyWorld(p)
+	world[0][0], world[1][4], world[2][2] = 0xFF, 0xFF, 0xFF
+
+	var buf bytes.Buffer
+	require.NoError(t, encodePgm(&buf, p.imageWidth, p.imageHeight, world))
+	h, decoded, err := parseNetpbm(&buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, netpbmHeader{magic: "P5", width: 5, height: 3, maxval: 255}, h)
+	assert.Equal(t, world, decoded)
+}
+
+func TestInferImageSize(t *testing.T) {
+	p, err := inferImageSize(golParams{imageWidth: 512, imageHeight: 512, pattern: "64x64.pgm"})
+	require.NoError(t, err)
+	assert.Equal(t, 64, p.imageWidth)
+	assert.Equal(t, 64, p.imageHeight)
+
+	// Other formats keep the size they were given
+	p, err = inferImageSize(golParams{imageWidth: 20, imageHeight: 30, pattern: "glider.rle"})
+	require.NoError(t, err)
+	assert.Equal(t, 20, p.imageWidth)
+	assert.Equal(t, 30, p.imageHeight)
+
+	_, err = inferImageSize(golParams{pattern: "missing.pgm"})
+	assert.Error(t, err)
+}
+
+func FuzzParseNetpbm(f *testing.F) {
+	for _, seed := range []string{
+		"P5\n3 2\n255\n\x00\xff\x00\xff\x00\xff",
+		"P5 # comment\n3 2\n65535\n\x00\x00\xff\xff\x00\x00\x01\x01\x00\x00\x80\x00",
+		"P2\n3 2\n15\n0 15 0\n8 0 9\n",
+		"P1\n3 2\n010\n101",
+		"P4\n3 2\n\x40\xa0",
+	} {
+		f.Add([]byte(seed), 0)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, threshold int) {
+		h, world, err := parseNetpbm(bytes.NewReader(data), threshold)
+		if err != nil {
+			return
+		}
+		require.Len(t, world, h.height)
+		for _, row := range world {
+			require.Len(t, row, h.width)
+		}
+
+		// Whatever was read should survive being written out and read back
+		var buf bytes.Buffer
+		require.NoError(t, encodePgm(&buf, h.width, h.height, world))
+		_, decoded, err := parseNetpbm(&buf, 0)
+		require.NoError(t, err)
+		require.Equal(t, world, decoded)
+	})
+}
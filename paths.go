@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultOutput is the output template used when p.output is empty.
+const defaultOutput = "out/{width}x{height}-{turns}"
+
+// outputTimeFormat is how {time} is written in output names, avoiding characters that aren't allowed in filenames.
+const outputTimeFormat = "20060102-150405"
+
+// messages returns where the game prints what it is doing, which is nowhere if p.quiet is set.
+// main sends them to stderr while stdout is an output, so that nothing else is printed into it,
+// and nowhere while the board is drawn in the terminal.
+func (p golParams) messages() io.Writer {
+	switch {
+	case p.quiet:
+		return ioutil.Discard
+	case p.messageOut != nil:
+		return p.messageOut
+	}
+	return os.Stdout
+}
+
+var outputPlaceholder = regexp.MustCompile(`\{[a-z]*\}`)
+
+// outputPlaceholders returns the value of every placeholder allowed in an output template.
+func outputPlaceholders(p golParams, turn int, now time.Time) map[string]string {
+	return map[string]string{
+		"{turn}":   strconv.Itoa(turn),
+		"{turns}":  strconv.Itoa(p.turns),
+		"{width}":  strconv.Itoa(p.imageWidth),
+		"{height}": strconv.Itoa(p.imageHeight),
+		"{rule}":   strings.Replace(conwayRule, "/", "", -1),
+		"{time}":   now.Format(outputTimeFormat),
+	}
+}
+
+// checkOutputTemplate makes sure every placeholder in template is one that expandOutput knows.
+func checkOutputTemplate(template string) error {
+	known := outputPlaceholders(golParams{}, 0, time.Time{})
+	for _, placeholder := range outputPlaceholder.FindAllString(template, -1) {
+		if _, ok := known[placeholder]; !ok {
+			return fmt.Errorf("unknown placeholder %s in output name %q", placeholder, template)
+		}
+	}
+	return nil
+}
+
+// expandOutput fills in the placeholders of an output template.
+// Unknown placeholders are left as they are.
+func expandOutput(template string, p golParams, turn int, now time.Time) string {
+	values := outputPlaceholders(p, turn, now)
+	return outputPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if value, ok := values[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// outputPath returns where an image of the given turn is written, adding ext if the template doesn't give an extension.
+func outputPath(p golParams, turn int, ext string) string {
+	template := p.output
+	if template == "" {
+		template = defaultOutput
+	}
+	path := expandOutput(template, p, turn, time.Now())
+	if path != "-" && filepath.Ext(path) == "" {
+		path += ext
+	}
+	return path
+}
+
+// animationPath returns where the gif of a run is written, which is the output path with a .gif extension.
+// If images are being written to stdout, the gif goes to the default output directory instead.
+func animationPath(p golParams, turn int) string {
+	if p.output == "-" {
+		p.output = ""
+	}
+	path := outputPath(p, turn, ".gif")
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".gif"
+}
+
+// inputPath returns the file the starting world is read from, with "-" meaning stdin.
+func inputPath(p golParams) string {
+	switch {
+	case p.input != "":
+		return p.input
+	case p.pattern != "":
+		return filepath.Join("images", p.pattern)
+	}
+	return filepath.Join("images", strconv.Itoa(p.imageWidth)+"x"+strconv.Itoa(p.imageHeight)+".pgm")
+}
+
+// readInput returns the contents of the file at path, or of stdin if path is "-".
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// createOutput creates the file at path along with any missing directories, or returns stdout if path is "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// checkPaths reports problems with the input and output paths in p before the game starts,
+// so that a missing file is an error message rather than a panic halfway through.
+func checkPaths(p golParams) error {
+	if path := inputPath(p); path != "-" {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	return checkOutputTemplate(p.output)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandOutput(t *testing.T) {
+	p := golParams{turns: 100, imageWidth: 32, imageHeight: 16}
+	now := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, "out/32x16-100", expandOutput(defaultOutput, p, 7, now))
+	assert.Equal(t, "runs/B3S23/32x16-t7-20200304-050607.png",
+		expandOutput("runs/{rule}/{width}x{height}-t{turn}-{time}.png", p, 7, now))
+	assert.Equal(t, "{nope}-7", expandOutput("{nope}-{turn}", p, 7, now))
+
+	assert.NoError(t, checkOutputTemplate(""))
+	assert.NoError(t, checkOutputTemplate("-"))
+	assert.NoError(t, checkOutputTemplate(defaultOutput))
+	assert.Error(t, checkOutputTemplate("out/{nope}"))
+}
+
+func TestOutputPath(t *testing.T) {
+	p := golParams{turns: 10, imageWidth: 16, imageHeight: 16}
+	assert.Equal(t, "out/16x16-10.pgm", outputPath(p, 3, ".pgm"))
+	assert.Equal(t, "out/16x16-10.gif", animationPath(p, 3))
+
+	p.output = "results/final-{turn}.png"
+	assert.Equal(t, "results/final-3.png", outputPath(p, 3, ".pgm"))
+	assert.Equal(t, "results/final-3.gif", animationPath(p, 3))
+
+	p.output = "-"
+	assert.Equal(t, "-", outputPath(p, 3, ".pgm"))
+	assert.Equal(t, "out/16x16-10.gif", animationPath(p, 3))
+}
+
+func TestInputPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("images", "64x32.pgm"), inputPath(golParams{imageWidth: 64, imageHeight: 32}))
+	assert.Equal(t, filepath.Join("images", "glider.rle"), inputPath(golParams{pattern: "glider.rle"}))
+	assert.Equal(t, "-", inputPath(golParams{pattern: "glider.rle", input: "-"}))
+
+	assert.NoError(t, checkPaths(golParams{imageWidth: 16, imageHeight: 16}))
+	assert.NoError(t, checkPaths(golParams{input: "-"}))
+	assert.Error(t, checkPaths(golParams{imageWidth: 17, imageHeight: 16}))
+	assert.Error(t, checkPaths(golParams{input: "nowhere/board.pgm"}))
+	assert.Error(t, checkPaths(golParams{imageWidth: 16, imageHeight: 16, output: "{size}"}))
+}
+
+func TestCreateOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Missing directories are made
+	file, err := createOutput(filepath.Join(dir, "a", "b", "board.pgm"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// stdout is left open for whatever is written next
+	file, err = createOutput("-")
+	require.NoError(t, err)
+	assert.Equal(t, nopWriteCloser{os.Stdout}, file)
+	require.NoError(t, file.Close())
+}
+
+// TestInputOutputPaths runs a game from a file outside images/ and writes the result to a templated path.
+func TestInputOutputPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol-paths")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "start.rle")
+	require.NoError(t, ioutil.WriteFile(input, []byte("x = 3, y = 1\n3o!\n"), 0644))
+	p := golParams{
+		turns:       5,
+		threads:     2,
+		imageWidth:  8,
+		imageHeight: 8,
+		input:       input,
+		output:      filepath.Join(dir, "{rule}", "final-{turn}"),
+	}
+	alive, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+	// A blinker is vertical after an odd number of turns
+	assert.ElementsMatch(t, []cell{{3, 2}, {3, 3}, {3, 4}}, alive)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "B3S23", "final-5.pgm"))
+	require.NoError(t, err)
+	_, world, err := parseNetpbm(bytes.NewReader(data), 0)
+	require.NoError(t, err)
+	assert.Len(t, aliveCells(world), 3)
+}
+
+// TestOutputFormatFromExtension writes the final board to an .rle output without -format, which must be RLE.
+func TestOutputFormatFromExtension(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	p := golParams{turns: 0, threads: 2, imageWidth: 16, imageHeight: 16, output: filepath.Join(dir, "snap.rle"), quiet: true}
+	alive, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "snap.rle"))
+	require.NoError(t, err)
+	assert.Equal(t, "rle", detectFormat("board", data))
+	pat, err := parseRle(bytes.NewReader(data))
+	require.NoError(t, err)
+	world, err := placePattern(p, pat)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, alive, aliveCells(world))
+
+	assert.Equal(t, "life106", outputFormatName(golParams{output: "out/board.LIF"}))
+	assert.Equal(t, "pgm", outputFormatName(golParams{output: "out/board"}))
+	assert.Equal(t, "cells", outputFormatName(golParams{output: "out/board.rle", outputFormat: "cells"}))
+	assert.NoError(t, checkOutputFormat(golParams{output: "out/board.lif", outputFormat: "life105"}))
+	assert.Error(t, checkOutputFormat(golParams{output: "out/board.rle", outputFormat: "pgm"}))
+}
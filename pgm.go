@@ -1,38 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"io"
 	"strconv"
-	"strings"
 )
 
-func check(e error) {
-	if e != nil {
-		panic(e)
-	}
-}
-
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-// Note that this function is incomplete. Use the commented-out for loop to receive data from the distributor.
-func writePgmImage(p golParams, i ioChans) {
-	_ = os.Mkdir("out", os.ModePerm)
-
-	filename := <-i.distributor.filename
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(p.imageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(p.imageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
-
+// receiveImage receives a whole world from the distributor, one byte at a time.
+func receiveImage(p golParams, i ioChans) [][]byte {
 	world := make([][]byte, p.imageHeight)
 	for i := range world {
 		world[i] = make([]byte, p.imageWidth)
@@ -43,67 +19,88 @@ func writePgmImage(p golParams, i ioChans) {
 			world[y][x] = <-i.distributor.outputVal
 		}
 	}
+	return world
+}
 
+// sendImage sends a whole world to the distributor, one byte at a time.
+func sendImage(p golParams, i ioChans, world [][]byte) {
 	for y := 0; y < p.imageHeight; y++ {
 		for x := 0; x < p.imageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			check(ioError)
+			i.distributor.inputVal <- world[y][x]
 		}
 	}
-	ioError = file.Sync()
-	check(ioError)
-
-	fmt.Println("File", filename, "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
-func readPgmImage(p golParams, i ioChans) {
-	filename := <-i.distributor.filename
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	check(ioError)
-
-	fields := strings.Fields(string(data))
-
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
+// encodePgm writes world to w as a binary (P5) pgm image.
+func encodePgm(w io.Writer, width, height int, world [][]byte) error {
+	header := "P5\n" + strconv.Itoa(width) + " " + strconv.Itoa(height) + "\n" + strconv.Itoa(255) + "\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
 	}
-
-	width, _ := strconv.Atoi(fields[1])
-	if width != p.imageWidth {
-		panic("Incorrect width")
+	for y := 0; y < height; y++ {
+		if _, err := w.Write(world[y][:width]); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != p.imageHeight {
-		panic("Incorrect height")
+// readPgmImage reads the world from the data of a pbm or pgm file.
+func readPgmImage(p golParams, filename string, data []byte) ([][]byte, error) {
+	header, world, err := parseNetpbm(bytes.NewReader(data), p.threshold)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
 	}
-
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	if header.width != p.imageWidth || header.height != p.imageHeight {
+		return nil, fmt.Errorf("%s is %dx%d but the board is %dx%d", filename, header.width, header.height, p.imageWidth, p.imageHeight)
 	}
+	return world, nil
+}
 
-	image := []byte(fields[4])
-
-	for _, b := range image {
-		i.distributor.inputVal <- b
+// readImage reads the starting world from filename, in the format detected by detectFormat.
+func readImage(p golParams, filename string) ([][]byte, error) {
+	data, err := readInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch format := detectFormat(filename, data); format {
+	case "pgm":
+		return readPgmImage(p, filename, data)
+	default:
+		return readPatternImage(p, filename, data, format)
 	}
-
-	fmt.Println("File", filename, "input done!")
 }
 
+// pgmIo handles all file input and output for the distributor.
+// Input files are read in the format detected by detectFormat.
+// Output files are written in the format given by outputFormatName.
+// Frames sent with ioFrame are kept until ioAnimation writes them to a gif.
+// Input, output and animation commands are answered on the err chan, before the world is sent for input
+// and after the file is written for output, so the distributor always finds out what went wrong.
 func pgmIo(p golParams, i ioChans) {
+	frames := newAnimation(styleFor(p))
 	for {
 		select {
-		case command := <-i.distributor.command:
+		case command, ok := <-i.distributor.command:
+			if !ok {
+				// The game is over
+				return
+			}
 			switch command {
 			case ioInput:
-				readPgmImage(p, i)
+				filename := <-i.distributor.filename
+				world, err := readImage(p, filename)
+				i.distributor.err <- err
+				if err == nil {
+					sendImage(p, i, world)
+					fmt.Fprintln(p.messages(), "File", filename, "input done!")
+				}
 			case ioOutput:
-				writePgmImage(p, i)
-
-			case ioCheckIdle:
-				i.distributor.idle <- true
+				i.distributor.err <- writeImage(p, i, <-i.distributor.filename)
+			case ioFrame:
+				frames.add(p.imageWidth, p.imageHeight, receiveImage(p, i))
+			case ioAnimation:
+				i.distributor.err <- writeAnimation(frames, <-i.distributor.filename, p.messages())
 			}
 		}
 	}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+)
+
+// palettes are the colour schemes that png and gif images can be drawn in, as {dead, alive}.
+var palettes = map[string]color.Palette{
+	"mono":      {color.Black, color.White},
+	"inverted":  {color.White, color.Black},
+	"green":     {color.RGBA{0x0c, 0x1a, 0x0c, 0xff}, color.RGBA{0x3c, 0xe6, 0x50, 0xff}},
+	"amber":     {color.RGBA{0x1a, 0x10, 0x00, 0xff}, color.RGBA{0xff, 0xb0, 0x00, 0xff}},
+	"blueprint": {color.RGBA{0x10, 0x2a, 0x5c, 0xff}, color.RGBA{0xe8, 0xf0, 0xff, 0xff}},
+}
+
+// paletteNames returns the names of the palettes in alphabetical order, for flag descriptions and errors.
+func paletteNames() string {
+	var names []string
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// maxAnimationFrames is the most frames kept for an animation, so that a long run can't use up all the memory.
+const maxAnimationFrames = 1000
+
+// animationDelay is the time each frame of an animation is shown for, in hundredths of a second.
+const animationDelay = 10
+
+// imageStyle is how a world is drawn as a picture.
+type imageStyle struct {
+	scale   int // Width and height in pixels of each cell
+	palette color.Palette
+}
+
+// styleFor returns the style set by p.scale and p.palette, falling back to one white pixel per alive cell.
+func styleFor(p golParams) imageStyle {
+	style := imageStyle{scale: p.scale, palette: palettes[p.palette]}
+	if style.scale < 1 {
+		style.scale = 1
+	}
+	if style.palette == nil {
+		style.palette = palettes["mono"]
+	}
+	return style
+}
+
+// draw returns world as a paletted image with each cell drawn as a scale x scale square.
+func (s imageStyle) draw(width, height int, world [][]byte) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, width*s.scale, height*s.scale), s.palette)
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*s.scale*img.Stride:]
+		for x := 0; x < width; x++ {
+			if world[y][x] != 0 {
+				for i := 0; i < s.scale; i++ {
+					row[x*s.scale+i] = 1
+				}
+			}
+		}
+		// The rest of the cell is the same as its first row of pixels
+		for i := 1; i < s.scale; i++ {
+			copy(img.Pix[(y*s.scale+i)*img.Stride:], row[:img.Stride])
+		}
+	}
+	return img
+}
+
+// encodePng writes world to w as a png image. Comments are not stored.
+func (s imageStyle) encodePng(w io.Writer, width, height int, world [][]byte, _ ...string) error {
+	return png.Encode(w, s.draw(width, height, world))
+}
+
+// animation collects frames of a run to be written as an animated gif.
+type animation struct {
+	style   imageStyle
+	frames  gif.GIF
+	dropped int // Frames not kept because there were already maxAnimationFrames
+}
+
+func newAnimation(style imageStyle) *animation {
+	return &animation{style: style}
+}
+
+// add draws world as the next frame.
+func (a *animation) add(width, height int, world [][]byte) {
+	if len(a.frames.Image) == maxAnimationFrames {
+		a.dropped++
+		return
+	}
+	a.frames.Image = append(a.frames.Image, a.style.draw(width, height, world))
+	a.frames.Delay = append(a.frames.Delay, animationDelay)
+}
+
+// encode writes every frame added so far to w as a looping gif.
+func (a *animation) encode(w io.Writer) error {
+	if len(a.frames.Image) == 0 {
+		return fmt.Errorf("gif: no frames to write")
+	}
+	return gif.EncodeAll(w, &a.frames)
+}
+
+// writeAnimation writes the frames of a to a gif at path, saying so on messages.
+func writeAnimation(a *animation, path string, messages io.Writer) error {
+	file, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	err = a.encode(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if a.dropped > 0 {
+		fmt.Fprintln(messages, "Warning: only the first", maxAnimationFrames, "frames of", path, "were kept")
+	}
+	fmt.Fprintln(messages, "File", path, "animation done!")
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStyleFor(t *testing.T) {
+	assert.Equal(t, imageStyle{scale: 1, palette: palettes["mono"]}, styleFor(golParams{}))
+	assert.Equal(t, imageStyle{scale: 3, palette: palettes["amber"]}, styleFor(golParams{scale: 3, palette: "amber"}))
+	assert.Equal(t, palettes["mono"], styleFor(golParams{palette: "nonsense"}).palette)
+}
+
+func TestDrawScaled(t *testing.T) {
+	world := testWorld(3, 2, cell{1, 0}, cell{2, 1})
+	img := imageStyle{scale: 2, palette: palettes["inverted"]}.draw(3, 2, world)
+	require.Equal(t, 6, img.Bounds().Dx())
+	require.Equal(t, 4, img.Bounds().Dy())
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 6; x++ {
+			want := color.Color(color.White)
+			if world[y/2][x/2] != 0 {
+				want = color.Black
+			}
+			assert.Equal(t, want, img.At(x, y), "(%d, %d)", x, y)
+		}
+	}
+}
+
+func TestEncodePng(t *testing.T) {
+	world := testWorld(4, 3, cell{0, 0}, cell{3, 2})
+	var buf bytes.Buffer
+	require.NoError(t, imageStyle{scale: 5, palette: palettes["green"]}.encodePng(&buf, 4, 3, world))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 20, img.Bounds().Dx())
+	assert.Equal(t, 15, img.Bounds().Dy())
+
+	alive, dead := color.RGBAModel.Convert(palettes["green"][1]), color.RGBAModel.Convert(palettes["green"][0])
+	assert.Equal(t, alive, color.RGBAModel.Convert(img.At(4, 4)))
+	assert.Equal(t, dead, color.RGBAModel.Convert(img.At(5, 4)))
+	assert.Equal(t, alive, color.RGBAModel.Convert(img.At(19, 14)))
+}
+
+func TestAnimation(t *testing.T) {
+	a := newAnimation(styleFor(golParams{}))
+	assert.Error(t, a.encode(&bytes.Buffer{}))
+
+	for i := 0; i < 3; i++ {
+		a.add(4, 4, testWorld(4, 4, cell{i, i}))
+	}
+	var buf bytes.Buffer
+	require.NoError(t, a.encode(&buf))
+	g, err := gif.DecodeAll(&buf)
+	require.NoError(t, err)
+	require.Len(t, g.Image, 3)
+	assert.Equal(t, []int{animationDelay, animationDelay, animationDelay}, g.Delay)
+	assert.Equal(t, uint8(1), g.Image[2].ColorIndexAt(2, 2))
+	assert.Equal(t, uint8(0), g.Image[2].ColorIndexAt(1, 1))
+
+	for i := 3; i < maxAnimationFrames+5; i++ {
+		a.add(4, 4, testWorld(4, 4))
+	}
+	assert.Len(t, a.frames.Image, maxAnimationFrames)
+	assert.Equal(t, 5, a.dropped)
+}
+
+// TestGifOutput runs a game with -gif and checks that a frame was written every few turns.
+func TestGifOutput(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 12, threads: 4, imageWidth: 16, imageHeight: 16, gifEvery: 4, output: filepath.Join(dir, "board")}
+	alive, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+
+	file, err := os.Open(filepath.Join(dir, "board.gif"))
+	require.NoError(t, err)
+	defer file.Close()
+	g, err := gif.DecodeAll(file)
+	require.NoError(t, err)
+
+	// Turns 0, 4, 8 and 12
+	require.Len(t, g.Image, 4)
+	var last []cell
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if g.Image[3].ColorIndexAt(x, y) == 1 {
+				last = append(last, cell{x: x, y: y})
+			}
+		}
+	}
+	assert.ElementsMatch(t, alive, last)
+}
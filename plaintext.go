@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseCells reads a plaintext (.cells) pattern, where '!' starts a comment line and each
+// other line is a row of '.' for dead cells and 'O' (or '*') for alive ones.
+func parseCells(r io.Reader) (lifePattern, error) {
+	pat := lifePattern{rule: conwayRule}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	rows := 0 // Rows seen so far, including blank ones that may turn out to be trailing
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			pat.comments = append(pat.comments, strings.TrimPrefix(line, "!"))
+			continue
+		}
+		for x, c := range line {
+			switch c {
+			case '.':
+			case 'O', '*':
+				pat.alive = append(pat.alive, cell{x: x, y: rows})
+			default:
+				return pat, fmt.Errorf("cells: unexpected character %q on row %d", c, rows)
+			}
+		}
+		if len(line) > pat.width {
+			pat.width = len(line)
+		}
+		rows++
+		if line != "" {
+			pat.height = rows
+		}
+	}
+	return pat, scanner.Err()
+}
+
+// encodeCells writes world to w as a plaintext pattern covering the whole board.
+func encodeCells(w io.Writer, width, height int, world [][]byte, comments ...string) error {
+	buf := bufio.NewWriter(w)
+	for _, comment := range comments {
+		fmt.Fprintf(buf, "!%s\n", comment)
+	}
+	row := make([]byte, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if world[y][x] != 0 {
+				row[x] = 'O'
+			} else {
+				row[x] = '.'
+			}
+		}
+		buf.Write(row)
+		buf.WriteByte('\n')
+	}
+	return buf.Flush()
+}
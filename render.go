@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// maxZoom is the furthest the view can zoom out, where each dot stands for a 2^maxZoom square of cells.
+const maxZoom = 8
+
+// panGlyphs is how many glyphs the view moves for each arrow key press.
+const panGlyphs = 8
+
+// view describes which part of the world is drawn in the terminal and how.
+type view struct {
+	x, y      int  // Cell shown in the top left corner
+	zoom      int  // Each dot shows a 2^zoom by 2^zoom square of cells, alive if any of them is
+	halfBlock bool // Draw 1x2 dots per glyph with half blocks instead of 2x4 with braille
+}
+
+// glyphSize returns how many dots wide and tall a single glyph is.
+func (v view) glyphSize() (int, int) {
+	if v.halfBlock {
+		return 1, 2
+	}
+	return 2, 4
+}
+
+// pan moves the view by the given number of glyphs, wrapping around the edges of the world.
+func (v *view) pan(dx, dy, width, height int) {
+	gw, gh := v.glyphSize()
+	v.x = ((v.x+dx*gw<<uint(v.zoom))%width + width) % width
+	v.y = ((v.y+dy*gh<<uint(v.zoom))%height + height) % height
+}
+
+// frame is a copy of the world sent from the distributor to the renderer.
+type frame struct {
+	world  [][]byte
+	turn   int
+	alive  int
+	state  progState
+	view   view
+	editor editor // Only drawn while paused
+
+	speed    int    // Target turns per second, 0 if unlimited
+	runUntil int    // Turn the game will pause at, 0 if none
+	count    string // Number being typed before a command
+	rewound  int    // Number of history entries undone
+}
+
+// braille dot bits, indexed by [y][x] within a 2x4 glyph.
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// downsample shrinks the world seen through v to one dot for each 2^zoom square of cells, alive if any of them is,
+// with the square of the first dot starting at (v.x, v.y). The world is a torus so the squares wrap around its
+// edges, but only cover it once: there are never more dots than it takes to show every cell, the last ones
+// covering what is left of the board. At most cols by rows dots are made, and every cell is looked at once at most.
+func downsample(world [][]byte, width, height int, v view, cols, rows int) [][]bool {
+	step := 1 << uint(v.zoom)
+	if n := (width + step - 1) / step; n < cols {
+		cols = n
+	}
+	if n := (height + step - 1) / step; n < rows {
+		rows = n
+	}
+
+	left := (v.x%width + width) % width
+	top := (v.y%height + height) % height
+	dots := make([][]bool, rows)
+	for j := range dots {
+		dots[j] = make([]bool, cols)
+		for dy := 0; dy < step && j*step+dy < height; dy++ {
+			row := world[(top+j*step+dy)%height]
+			for i := range dots[j] {
+				if dots[j][i] {
+					continue
+				}
+				for dx := 0; dx < step && i*step+dx < width; dx++ {
+					if row[(left+i*step+dx)%width] != 0 {
+						dots[j][i] = true
+						break
+					}
+				}
+			}
+		}
+	}
+	return dots
+}
+
+// renderGlyphs returns the characters needed to draw world through v in cols by rows glyphs.
+// Once the view has shown the whole board the rest of the glyphs are left blank rather than tiling the torus.
+func renderGlyphs(world [][]byte, width, height int, v view, cols, rows int) [][]rune {
+	gw, gh := v.glyphSize()
+	dots := downsample(world, width, height, v, cols*gw, rows*gh)
+	glyphs := make([][]rune, rows)
+	for row := range glyphs {
+		glyphs[row] = make([]rune, cols)
+		for col := range glyphs[row] {
+			var glyph [4][2]bool
+			for dy := 0; dy < gh; dy++ {
+				for dx := 0; dx < gw; dx++ {
+					if y, x := row*gh+dy, col*gw+dx; y < len(dots) && x < len(dots[y]) {
+						glyph[dy][dx] = dots[y][x]
+					}
+				}
+			}
+			glyphs[row][col] = glyphFor(glyph, v.halfBlock)
+		}
+	}
+	return glyphs
+}
+
+// glyphFor picks the character showing the given dots.
+func glyphFor(dots [4][2]bool, halfBlock bool) rune {
+	if halfBlock {
+		switch {
+		case dots[0][0] && dots[1][0]:
+			return '█'
+		case dots[0][0]:
+			return '▀'
+		case dots[1][0]:
+			return '▄'
+		}
+		return ' '
+	}
+
+	var bits rune
+	for y := range dots {
+		for x := range dots[y] {
+			if dots[y][x] {
+				bits |= brailleDots[y][x]
+			}
+		}
+	}
+	if bits == 0 {
+		return ' '
+	}
+	return 0x2800 + bits
+}
+
+// glyphAt returns the column and row of the glyph showing cell c, which may be off screen.
+func glyphAt(c cell, width, height int, v view) (int, int) {
+	gw, gh := v.glyphSize()
+	dx := ((c.x-v.x)%width + width) % width
+	dy := ((c.y-v.y)%height + height) % height
+	return dx / (gw << uint(v.zoom)), dy / (gh << uint(v.zoom))
+}
+
+// renderer draws every frame it receives in the terminal, with a status line at the bottom.
+// It returns once frames is closed, or if the terminal can't be drawn on.
+// renderer will NOT work if termbox isn't initialised (in startControlServer)
+func renderer(p golParams, frames <-chan frame) error {
+	lastTime := time.Now()
+	lastTurn := 0
+	turnsPerSecond := 0.0
+
+	for f := range frames {
+		now := time.Now()
+		if elapsed := now.Sub(lastTime).Seconds(); elapsed >= 0.5 {
+			turnsPerSecond = float64(f.turn-lastTurn) / elapsed
+			lastTime = now
+			lastTurn = f.turn
+		}
+
+		cols, rows := termbox.Size()
+		if err := termbox.Clear(termbox.ColorDefault, termbox.ColorDefault); err != nil {
+			return err
+		}
+		if rows > 1 {
+			glyphs := renderGlyphs(f.world, p.imageWidth, p.imageHeight, f.view, cols, rows-1)
+			for y, line := range glyphs {
+				for x, g := range line {
+					termbox.SetCell(x, y, g, termbox.ColorDefault, termbox.ColorDefault)
+				}
+			}
+		}
+
+		status := fmt.Sprintf("Turn %d | Alive %d | %.0f turns/s | %s | zoom 1:%d | (%d, %d)",
+			f.turn, f.alive, turnsPerSecond, f.state, 1<<uint(f.view.zoom), f.view.x, f.view.y)
+		if f.state == PAUSE {
+			// Highlight the glyphs under the cursor and mark
+			highlight := []cell{f.editor.cursor}
+			if f.editor.marked {
+				highlight = append(highlight, f.editor.mark)
+			}
+			for _, c := range highlight {
+				x, y := glyphAt(c, p.imageWidth, p.imageHeight, f.view)
+				if x < cols && y < rows-1 {
+					g := termbox.CellBuffer()[y*cols+x].Ch
+					termbox.SetCell(x, y, g, termbox.ColorBlack, termbox.ColorYellow)
+				}
+			}
+			status += fmt.Sprintf(" | cursor (%d, %d) | pattern %s",
+				f.editor.cursor.x, f.editor.cursor.y, patternLibrary[f.editor.pattern].name)
+		}
+		if f.speed != 0 {
+			status += fmt.Sprintf(" | limit %d/s", f.speed)
+		}
+		if f.runUntil != 0 {
+			status += fmt.Sprintf(" | until turn %d", f.runUntil)
+		}
+		if f.rewound != 0 {
+			status += fmt.Sprintf(" | rewound %d", f.rewound)
+		}
+		if f.count != "" {
+			status += " | " + f.count
+		}
+		for x, r := range []rune(status) {
+			termbox.SetCell(x, rows-1, r, termbox.ColorBlack, termbox.ColorWhite)
+		}
+		if err := termbox.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderGlyphs(t *testing.T) {
+	world := testWorld(8, 8, cell{x: 0, y: 0}, cell{x: 1, y: 3}, cell{x: 2, y: 1})
+
+	glyphs := renderGlyphs(world, 8, 8, view{}, 2, 1)
+	assert.Equal(t, [][]rune{{0x2800 + 0x01 + 0x80, 0x2800 + 0x02}}, glyphs)
+
+	glyphs = renderGlyphs(world, 8, 8, view{halfBlock: true}, 3, 2)
+	assert.Equal(t, [][]rune{{'▀', ' ', '▄'}, {' ', '▄', ' '}}, glyphs)
+
+	// Zoomed out, each dot covers a 2x2 square so (1, 3) and (2, 1) light up their own dots
+	glyphs = renderGlyphs(world, 8, 8, view{zoom: 1}, 1, 1)
+	assert.Equal(t, [][]rune{{0x2800 + 0x01 + 0x02 + 0x08}}, glyphs)
+
+	// Views wrap around the torus
+	glyphs = renderGlyphs(world, 8, 8, view{x: 7, y: 7, halfBlock: true}, 2, 1)
+	assert.Equal(t, [][]rune{{' ', '▄'}}, glyphs)
+
+	assert.Equal(t, [][]rune{{' ', ' '}}, renderGlyphs(testWorld(8, 8), 8, 8, view{}, 2, 1))
+}
+
+func TestDownsample(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		width, height := 1+r.Intn(40), 1+r.Intn(40)
+		c := randomSoup(r)
+		world := testWorld(width, height)
+		for _, alive := range c.alive {
+			world[alive.y%height][alive.x%width] = 0xFF
+		}
+		v := view{x: r.Intn(width), y: r.Intn(height), zoom: r.Intn(4)}
+		dots := downsample(world, width, height, v, 30, 30)
+
+		// Every dot is alive if any cell of its square is, and the squares cover the board once
+		step := 1 << uint(v.zoom)
+		covered := testWorld(width, height)
+		for j := range dots {
+			for i := range dots[j] {
+				alive := false
+				for dy := 0; dy < step && j*step+dy < height; dy++ {
+					for dx := 0; dx < step && i*step+dx < width; dx++ {
+						x, y := (v.x+i*step+dx)%width, (v.y+j*step+dy)%height
+						alive = alive || world[y][x] != 0
+						covered[y][x]++
+					}
+				}
+				assert.Equal(t, alive, dots[j][i], "dot (%d, %d) of %dx%d through %+v", i, j, width, height, v)
+			}
+		}
+		if (width+step-1)/step > 30 || (height+step-1)/step > 30 {
+			continue // Not all of the board fits
+		}
+		for y := range covered {
+			for x := range covered[y] {
+				assert.Equal(t, byte(1), covered[y][x], "cell (%d, %d) of %dx%d through %+v", x, y, width, height, v)
+			}
+		}
+	}
+}
+
+func TestRenderWholeBoard(t *testing.T) {
+	// Zoomed out past the size of the board it is drawn once, not tiled across the terminal
+	world := testWorld(512, 512, cell{x: 0, y: 0}, cell{x: 511, y: 511})
+	glyphs := renderGlyphs(world, 512, 512, view{zoom: maxZoom}, 200, 50)
+	assert.Equal(t, rune(0x2800+0x01+0x10), glyphs[0][0])
+	for y := range glyphs {
+		for x := range glyphs[y] {
+			if x != 0 || y != 0 {
+				assert.Equal(t, ' ', glyphs[y][x], "glyph (%d, %d)", x, y)
+			}
+		}
+	}
+}
+
+func TestViewPan(t *testing.T) {
+	v := view{}
+	v.pan(-1, 1, 16, 16)
+	assert.Equal(t, view{x: 14, y: 4}, v)
+
+	v = view{zoom: 2, halfBlock: true}
+	v.pan(3, -3, 16, 16)
+	assert.Equal(t, view{x: 12, y: 8, zoom: 2, halfBlock: true}, v)
+}
+
+func TestRenderFrames(t *testing.T) {
+	p := golParams{turns: 1000000000, threads: 2, imageWidth: 16, imageHeight: 16}
+	frames := make(chan frame, 1)
+	key, _, finalAlive := startKeyTest(t, p, externalChans{frames: frames})
+
+	key <- 'p'
+	key <- 'g'
+	key <- keyRight
+	key <- '-'
+
+	// The distributor replaces undrawn frames, so keep reading until the last key has been applied
+	want := view{x: 8, zoom: 1, halfBlock: true}
+	var f frame
+	for f.view != want {
+		select {
+		case f = <-frames:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no frame with the expected view", "last view %+v", f.view)
+		}
+	}
+	assert.Equal(t, PAUSE, f.state)
+	assert.Equal(t, 5, f.alive)
+	assert.Len(t, f.world, 16)
+
+	key <- 'q'
+	for range frames {
+	}
+	<-finalAlive
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseRleHeader reads the "x = m, y = n, rule = abc" line.
+func parseRleHeader(line string, pat *lifePattern) error {
+	pat.rule = conwayRule
+	seen := map[string]bool{}
+	for _, field := range strings.Split(line, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("rle: malformed header field %q", field)
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		seen[key] = true
+		switch key {
+		case "x", "y":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("rle: invalid %s %q", key, value)
+			}
+			if key == "x" {
+				pat.width = n
+			} else {
+				pat.height = n
+			}
+		case "rule":
+			pat.rule = normaliseRule(value)
+		}
+	}
+	if !seen["x"] || !seen["y"] {
+		return errors.New("rle: header must give x and y")
+	}
+	return nil
+}
+
+// parseRle reads an RLE pattern.
+// Multi-state letters (A-X, optionally prefixed by p-y) are all treated as alive.
+func parseRle(r io.Reader) (lifePattern, error) {
+	var pat lifePattern
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	headerRead := false
+	x, y := 0, 0
+	count := 0
+	maxRun := 0 // Longest run that fits in the pattern, so that a count can neither overflow nor allocate without limit
+	prefixed := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !headerRead {
+			switch {
+			case line == "":
+			case strings.HasPrefix(line, "#C"), strings.HasPrefix(line, "#c"), strings.HasPrefix(line, "#N"):
+				pat.comments = append(pat.comments, strings.TrimSpace(line[2:]))
+			case strings.HasPrefix(line, "#"):
+				pat.comments = append(pat.comments, strings.TrimPrefix(line, "#"))
+			default:
+				if err := parseRleHeader(line, &pat); err != nil {
+					return pat, err
+				}
+				headerRead = true
+				maxRun = pat.width
+				if pat.height > maxRun {
+					maxRun = pat.height
+				}
+			}
+			continue
+		}
+
+		for _, c := range line {
+			switch {
+			case c >= '0' && c <= '9':
+				digit := int(c - '0')
+				if count > (maxRun-digit)/10 {
+					return pat, fmt.Errorf("rle: run is longer than the %dx%d pattern", pat.width, pat.height)
+				}
+				count = count*10 + digit
+				continue
+			case c >= 'p' && c <= 'y':
+				// First half of a two letter state, the second letter says how many cells
+				prefixed = true
+				continue
+			case c == ' ' || c == '\t':
+				continue
+			}
+
+			run := count
+			if run == 0 {
+				run = 1
+			}
+			count = 0
+			switch {
+			case c == 'b' || c == '.':
+				if prefixed {
+					return pat, fmt.Errorf("rle: unexpected %q after state prefix", c)
+				}
+				if run > pat.width-x {
+					return pat, fmt.Errorf("rle: row %d is wider than the %dx%d pattern", y, pat.width, pat.height)
+				}
+				x += run
+			case c == 'o' || (c >= 'A' && c <= 'X'):
+				prefixed = false
+				if run > pat.width-x || y >= pat.height {
+					return pat, fmt.Errorf("rle: cell (%d, %d) is outside the %dx%d pattern", x+run-1, y, pat.width, pat.height)
+				}
+				for i := 0; i < run; i++ {
+					pat.alive = append(pat.alive, cell{x: x + i, y: y})
+				}
+				x += run
+			case c == '$':
+				if run > pat.height-y {
+					return pat, fmt.Errorf("rle: more rows than the %dx%d pattern", pat.width, pat.height)
+				}
+				y += run
+				x = 0
+			case c == '!':
+				return pat, checkRleBounds(pat)
+			default:
+				return pat, fmt.Errorf("rle: unexpected character %q", c)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	if !headerRead {
+		return pat, errors.New("rle: missing header")
+	}
+	return pat, checkRleBounds(pat)
+}
+
+// checkRleBounds makes sure every alive cell fits in the size given by the header.
+func checkRleBounds(pat lifePattern) error {
+	for _, c := range pat.alive {
+		if c.x < 0 || c.y < 0 || c.x >= pat.width || c.y >= pat.height {
+			return fmt.Errorf("rle: cell (%d, %d) is outside the %dx%d pattern", c.x, c.y, pat.width, pat.height)
+		}
+	}
+	return nil
+}
+
+// rleLineLength is the longest line encodeRle writes, as recommended by the format.
+const rleLineLength = 70
+
+// encodeRle writes world to w as an RLE pattern covering the whole board.
+func encodeRle(w io.Writer, width, height int, world [][]byte, comments ...string) error {
+	buf := bufio.NewWriter(w)
+	for _, comment := range comments {
+		fmt.Fprintf(buf, "#C %s\n", comment)
+	}
+	fmt.Fprintf(buf, "x = %d, y = %d, rule = %s\n", width, height, conwayRule)
+
+	lineLength := 0
+	writeRun := func(run int, tag byte) {
+		token := string(tag)
+		if run > 1 {
+			token = strconv.Itoa(run) + token
+		}
+		if lineLength+len(token) > rleLineLength {
+			buf.WriteByte('\n')
+			lineLength = 0
+		}
+		buf.WriteString(token)
+		lineLength += len(token)
+	}
+
+	pendingRows := 0
+	for y := 0; y < height; y++ {
+		// Trailing dead cells in a row are left out
+		end := width
+		for end > 0 && world[y][end-1] == 0 {
+			end--
+		}
+		if end == 0 {
+			pendingRows++
+			continue
+		}
+		if pendingRows > 0 {
+			writeRun(pendingRows, '$')
+			pendingRows = 0
+		}
+		for x := 0; x < end; {
+			alive := world[y][x] != 0
+			run := 1
+			for x+run < end && (world[y][x+run] != 0) == alive {
+				run++
+			}
+			if alive {
+				writeRun(run, 'o')
+			} else {
+				writeRun(run, 'b')
+			}
+			x += run
+		}
+		pendingRows = 1
+	}
+	writeRun(1, '!')
+	buf.WriteByte('\n')
+	return buf.Flush()
+}
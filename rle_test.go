@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRle(t *testing.T) {
+	pat, err := parseRle(strings.NewReader(`#N Glider
+#C A comment
+#c  Another
+x = 3, y = 3, rule = B3/S23
+bob$2bo$3o!`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, pat.width)
+	assert.Equal(t, 3, pat.height)
+	assert.Equal(t, "B3/S23", pat.rule)
+	assert.Equal(t, []string{"Glider", "A comment", "Another"}, pat.comments)
+	assert.Equal(t, []cell{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}}, pat.alive)
+
+	// Multi-state letters count as alive, runs can span lines and S/B rules are converted
+	pat, err = parseRle(strings.NewReader(`x = 5, y = 4, rule = 23/3
+2A.pB$
+2$o3b
+o!`))
+	require.NoError(t, err)
+	assert.Equal(t, "B3/S23", pat.rule)
+	assert.Equal(t, []cell{{0, 0}, {1, 0}, {3, 0}, {0, 3}, {4, 3}}, pat.alive)
+
+	// A missing rule means Conway's Life and a missing ! ends the pattern at the end of the file
+	pat, err = parseRle(strings.NewReader("x = 2, y = 1\n2o"))
+	require.NoError(t, err)
+	assert.Equal(t, conwayRule, pat.rule)
+	assert.Len(t, pat.alive, 2)
+
+	pat, err = parseRle(strings.NewReader("x = 1, y = 1, rule = B36/S23\no!"))
+	require.NoError(t, err)
+	assert.Equal(t, "B36/S23", pat.rule)
+}
+
+func TestParseRleErrors(t *testing.T) {
+	for name, rle := range map[string]string{
+		"no header":       "bo$2bo$3o!",
+		"empty":           "",
+		"no y":            "x = 3\n3o!",
+		"bad size":        "x = three, y = 3\n3o!",
+		"bad character":   "x = 3, y = 3\n3z!",
+		"outside bounds":  "x = 2, y = 2\n3o!",
+		"prefix then b":   "x = 2, y = 2\npb!",
+		"overflowing run": "x = 3, y = 3\n9223372036854775807b2bo!",
+		"long run":        "x = 3, y = 3\n4b!",
+		"huge run":        "x = 3, y = 3\n1000000000000o!",
+		"too many rows":   "x = 3, y = 3\no4$o!",
+		"row below":       "x = 3, y = 3\n3$o!",
+	} {
+		_, err := parseRle(strings.NewReader(rle))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEncodeRle(t *testing.T) {
+	world := testWorld(8, 6, cell{1, 1}, cell{2, 1}, cell{3, 1}, cell{7, 4})
+	var buf bytes.Buffer
+	require.NoError(t, encodeRle(&buf, 8, 6, world, "turn 3"))
+	assert.Equal(t, "#C turn 3\nx = 8, y = 6, rule = B3/S23\n$b3o3$7bo!\n", buf.String())
+
+	// Long patterns are wrapped to 70 characters
+	wide := make([][]byte, 1)
+	wide[0] = make([]byte, 200)
+	for x := 0; x < 200; x += 2 {
+		wide[0][x] = 0xFF
+	}
+	buf.Reset()
+	require.NoError(t, encodeRle(&buf, 200, 1, wide))
+	for _, line := range strings.Split(buf.String(), "\n") {
+		assert.True(t, len(line) <= rleLineLength, "line too long: %q", line)
+	}
+}
+
+func TestRleRoundTrip(t *testing.T) {
+	world := testWorld(16, 16, cell{4, 5}, cell{5, 6}, cell{3, 7}, cell{4, 7}, cell{5, 7}, cell{15, 15}, cell{0, 15})
+	var buf bytes.Buffer
+	require.NoError(t, encodeRle(&buf, 16, 16, world, "board.rle", "second line"))
+
+	pat, err := parseRle(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"board.rle", "second line"}, pat.comments)
+	p := golParams{imageWidth: 16, imageHeight: 16}
+	decoded, err := centrePattern(p, pat.width, pat.height, pat.alive)
+	require.NoError(t, err)
+	assert.Equal(t, world, decoded)
+}
+
+func TestCentrePattern(t *testing.T) {
+	p := golParams{imageWidth: 8, imageHeight: 5}
+	world, err := centrePattern(p, 3, 1, []cell{{0, 0}, {2, 0}})
+	require.NoError(t, err)
+	assert.Equal(t, testWorld(8, 5, cell{2, 2}, cell{4, 2}), world)
+
+	_, err = centrePattern(p, 9, 1, nil)
+	assert.Error(t, err)
+}
+
+// readThroughIo asks a new io goroutine to read filename from images/ and returns the alive cells it sends back.
+func readThroughIo(t *testing.T, p golParams, filename string) []cell {
+	command := make(chan ioCommand)
+	names := make(chan string)
+	inputVal := make(chan uint8)
+	var i ioChans
+	i.distributor.command = command
+	i.distributor.filename = names
+	i.distributor.inputVal = inputVal
+	ioErr := make(chan error)
+	i.distributor.err = ioErr
+	go pgmIo(p, i)
+
+	command <- ioInput
+	names <- filepath.Join("images", filename)
+	require.NoError(t, <-ioErr)
+	var alive []cell
+	for y := 0; y < p.imageHeight; y++ {
+		for x := 0; x < p.imageWidth; x++ {
+			if <-inputVal != 0 {
+				alive = append(alive, cell{x: x, y: y})
+			}
+		}
+	}
+	return alive
+}
+
+func TestLoadRlePattern(t *testing.T) {
+	p := golParams{imageWidth: 16, imageHeight: 16}
+	alive := readThroughIo(t, p, "glider.rle")
+	assert.Equal(t, []cell{{7, 6}, {8, 7}, {6, 8}, {7, 8}, {8, 8}}, alive)
+}
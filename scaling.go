@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scalingConfig is what a scaling study sweeps over.
+type scalingConfig struct {
+	threads []int
+	sizes   []imageSize
+	turns   []int
+	repeats int
+}
+
+type imageSize struct {
+	width, height int
+}
+
+// scalingResult is how long one board size and number of turns took with one number of threads.
+type scalingResult struct {
+	width, height, turns, threads int
+	seconds                       float64 // Median of the repeated runs
+	speedup                       float64 // How many times faster than the fewest threads of the series
+	efficiency                    float64 // Speedup for each thread added, where 1 is perfect scaling
+}
+
+// throughput is how many cells were updated each second.
+func (r scalingResult) throughput() float64 {
+	return float64(r.width) * float64(r.height) * float64(r.turns) / r.seconds
+}
+
+// series names the board size and number of turns the result belongs to.
+func (r scalingResult) series() string {
+	return fmt.Sprintf("%dx%d, %d turns", r.width, r.height, r.turns)
+}
+
+// parseIntList parses a comma separated list of positive numbers.
+func parseIntList(name, list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("%s must be a comma separated list of positive numbers, not %q", name, list)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// parseSizes parses a comma separated list of sizes like 128x128.
+func parseSizes(list string) ([]imageSize, error) {
+	var sizes []imageSize
+	for _, field := range strings.Split(list, ",") {
+		var s imageSize
+		if n, err := fmt.Sscanf(strings.TrimSpace(field), "%dx%d", &s.width, &s.height); err != nil || n != 2 ||
+			s.width <= 0 || s.height <= 0 {
+			return nil, fmt.Errorf("sizes must be a comma separated list like 128x128,512x512, not %q", list)
+		}
+		sizes = append(sizes, s)
+	}
+	return sizes, nil
+}
+
+// timeGame plays a game and returns how long it took, which includes waiting for its goroutines to return
+// so that none of them are left running to slow down the next game.
+func timeGame(p golParams) (time.Duration, error) {
+	start := time.Now()
+	_, err := gameOfLife(p, nil)
+	return time.Since(start), err
+}
+
+// runScalingStudy quietly plays every combination of size, turns and threads c.repeats times with play, which returns
+// how long the game took. Thread counts larger than the board height are skipped. progress is told about each result.
+func runScalingStudy(c scalingConfig, output string, play func(p golParams) (time.Duration, error),
+	progress io.Writer) ([]scalingResult, error) {
+	var results []scalingResult
+	for _, size := range c.sizes {
+		for _, turns := range c.turns {
+			series := len(results)
+			for _, threads := range c.threads {
+				if threads > size.height {
+					fmt.Fprintf(progress, "Skipping %d threads on %dx%d, which is only %d rows high\n",
+						threads, size.width, size.height, size.height)
+					continue
+				}
+				p := golParams{turns: turns, threads: threads, imageWidth: size.width, imageHeight: size.height, output: output,
+					quiet: true}
+				times := make([]float64, c.repeats)
+				for i := range times {
+					d, err := play(p)
+					if err != nil {
+						return nil, err
+					}
+					times[i] = d.Seconds()
+				}
+				sort.Float64s(times)
+				r := scalingResult{width: size.width, height: size.height, turns: turns, threads: threads, seconds: times[len(times)/2]}
+				results = append(results, r)
+				fmt.Fprintf(progress, "%s, %d threads: %.3fs\n", r.series(), threads, r.seconds)
+			}
+			addSpeedups(results[series:])
+		}
+	}
+	return results, nil
+}
+
+// addSpeedups fills in the speedup and efficiency of a series of results, relative to the one with the fewest threads.
+func addSpeedups(series []scalingResult) {
+	if len(series) == 0 {
+		return
+	}
+	base := series[0]
+	for _, r := range series {
+		if r.threads < base.threads {
+			base = r
+		}
+	}
+	for i := range series {
+		series[i].speedup = base.seconds / series[i].seconds
+		series[i].efficiency = series[i].speedup * float64(base.threads) / float64(series[i].threads)
+	}
+}
+
+func writeScalingCSV(w io.Writer, results []scalingResult) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"width", "height", "turns", "threads", "seconds", "cells_per_second", "speedup", "efficiency"})
+	for _, r := range results {
+		_ = out.Write([]string{
+			strconv.Itoa(r.width), strconv.Itoa(r.height), strconv.Itoa(r.turns), strconv.Itoa(r.threads),
+			strconv.FormatFloat(r.seconds, 'g', 6, 64),
+			strconv.FormatFloat(r.throughput(), 'g', 6, 64),
+			strconv.FormatFloat(r.speedup, 'f', 3, 64),
+			strconv.FormatFloat(r.efficiency, 'f', 3, 64),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Layout of the scaling chart, which has a panel for each measure side by side with a legend underneath.
+const (
+	chartPanelWidth  = 320
+	chartPanelHeight = 260
+	chartMarginLeft  = 60
+	chartMarginRight = 15
+	chartMarginTop   = 30
+	chartMarginBase  = 40
+	chartLegendRow   = 18
+)
+
+var chartColours = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+// chartPanel is one measure plotted against the number of threads.
+type chartPanel struct {
+	title string
+	value func(r scalingResult) float64
+	ideal func(threads, baseThreads int) float64 // Dashed line of perfect scaling, if there is one
+}
+
+var chartPanels = []chartPanel{
+	{"Throughput (cells/s)", scalingResult.throughput, nil},
+	{"Speedup", func(r scalingResult) float64 { return r.speedup },
+		func(threads, base int) float64 { return float64(threads) / float64(base) }},
+	{"Parallel efficiency", func(r scalingResult) float64 { return r.efficiency },
+		func(int, int) float64 { return 1 }},
+}
+
+// niceCeiling rounds v up to 1, 2 or 5 times a power of ten, for the top of an axis.
+func niceCeiling(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if v <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// formatSI writes v with an SI prefix, such as 1.5M.
+func formatSI(v float64) string {
+	for _, prefix := range []struct {
+		size   float64
+		symbol string
+	}{{1e9, "G"}, {1e6, "M"}, {1e3, "k"}} {
+		if math.Abs(v) >= prefix.size {
+			return strconv.FormatFloat(v/prefix.size, 'g', 3, 64) + prefix.symbol
+		}
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
+
+// noinspection GoUnhandledErrorResult
+func writeScalingSVG(w io.Writer, results []scalingResult) error {
+	if len(results) == 0 {
+		return errors.New("no results to chart")
+	}
+
+	// Threads are spaced out by their logarithm, so doubling them always moves the same distance
+	var series []string
+	bySeries := map[string][]scalingResult{}
+	var allThreads []int
+	seenThreads := map[int]bool{}
+	for _, r := range results {
+		name := r.series()
+		if _, ok := bySeries[name]; !ok {
+			series = append(series, name)
+		}
+		bySeries[name] = append(bySeries[name], r)
+		if !seenThreads[r.threads] {
+			seenThreads[r.threads] = true
+			allThreads = append(allThreads, r.threads)
+		}
+	}
+	sort.Ints(allThreads)
+	minLog, maxLog := math.Log2(float64(allThreads[0])), math.Log2(float64(allThreads[len(allThreads)-1]))
+	plotWidth := float64(chartPanelWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartPanelHeight - chartMarginTop - chartMarginBase)
+	xOf := func(threads int) float64 {
+		if maxLog == minLog {
+			return chartMarginLeft + plotWidth/2
+		}
+		return chartMarginLeft + (math.Log2(float64(threads))-minLog)/(maxLog-minLog)*plotWidth
+	}
+
+	width := chartPanelWidth * len(chartPanels)
+	height := chartPanelHeight + chartLegendRow*len(series) + chartMarginTop/2
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(b, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+
+	for i, panel := range chartPanels {
+		top := 0.0
+		for _, r := range results {
+			top = math.Max(top, panel.value(r))
+		}
+		if panel.ideal != nil {
+			for _, name := range series {
+				rs := bySeries[name]
+				top = math.Max(top, panel.ideal(rs[len(rs)-1].threads, rs[0].threads))
+			}
+		}
+		top = niceCeiling(top)
+		yOf := func(v float64) float64 {
+			return chartMarginTop + plotHeight - v/top*plotHeight
+		}
+
+		fmt.Fprintf(b, `<g transform="translate(%d,0)">`+"\n", i*chartPanelWidth)
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle" font-size="13">%s</text>`+"\n",
+			chartMarginLeft+int(plotWidth)/2, chartMarginTop-12, html.EscapeString(panel.title))
+		for tick := 0; tick <= 4; tick++ {
+			v := top * float64(tick) / 4
+			y := yOf(v)
+			fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n", chartMarginLeft, y, chartMarginLeft+plotWidth, y)
+			fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`+"\n", chartMarginLeft-5, y+4, formatSI(v))
+		}
+		for _, threads := range allThreads {
+			x := xOf(threads)
+			fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle">%d</text>`+"\n", x, chartMarginTop+plotHeight+15, threads)
+		}
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle">threads</text>`+"\n",
+			chartMarginLeft+int(plotWidth)/2, chartPanelHeight-8)
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="#333"/>`+"\n",
+			chartMarginLeft, chartMarginTop, plotWidth, plotHeight)
+
+		for j, name := range series {
+			rs := bySeries[name]
+			colour := chartColours[j%len(chartColours)]
+			if panel.ideal != nil {
+				fmt.Fprintf(b, `<polyline fill="none" stroke="%s" stroke-opacity="0.4" stroke-dasharray="4 3" points="`, colour)
+				for _, r := range rs {
+					fmt.Fprintf(b, "%.1f,%.1f ", xOf(r.threads), yOf(panel.ideal(r.threads, rs[0].threads)))
+				}
+				fmt.Fprintln(b, `"/>`)
+			}
+			fmt.Fprintf(b, `<polyline fill="none" stroke="%s" stroke-width="2" points="`, colour)
+			for _, r := range rs {
+				fmt.Fprintf(b, "%.1f,%.1f ", xOf(r.threads), yOf(panel.value(r)))
+			}
+			fmt.Fprintln(b, `"/>`)
+			for _, r := range rs {
+				fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`+"\n", xOf(r.threads), yOf(panel.value(r)), colour)
+			}
+		}
+		fmt.Fprintln(b, "</g>")
+	}
+
+	for j, name := range series {
+		y := chartPanelHeight + chartLegendRow*j + chartMarginTop/2
+		colour := chartColours[j%len(chartColours)]
+		fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"/>`+"\n",
+			chartMarginLeft, y-4, chartMarginLeft+20, y-4, colour)
+		fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`+"\n", chartMarginLeft+26, y, html.EscapeString(name))
+	}
+	fmt.Fprintln(b, "</svg>")
+	return b.Flush()
+}
+
+// writeScalingFile writes the results to path with write.
+func writeScalingFile(path string, results []scalingResult, write func(io.Writer, []scalingResult) error) error {
+	file, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	err = write(file, results)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// runScaling is the scale subcommand, which runs a scaling study and writes the results as CSV and an SVG chart.
+func runScaling(args []string, progress io.Writer) error {
+	flags := flag.NewFlagSet("scale", flag.ContinueOnError)
+	threadList := flags.String("threads", "1,2,4,8", "Comma separated numbers of worker threads to run with.")
+	sizeList := flags.String("sizes", "64x64,128x128,256x256,512x512", "Comma separated board sizes, read from images/WxH.pgm.")
+	turnList := flags.String("turns", "100", "Comma separated numbers of turns to run for.")
+	repeats := flags.Int("repeats", 3, "Runs of each combination, of which the median time is used.")
+	csvPath := flags.String("csv", "out/scaling.csv", "Where to write the results as CSV, or - for stdout.")
+	svgPath := flags.String("svg", "out/scaling.svg", "Where to write the chart of the results, or - for stdout.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	var c scalingConfig
+	var err error
+	if c.threads, err = parseIntList("threads", *threadList); err != nil {
+		return err
+	}
+	if c.sizes, err = parseSizes(*sizeList); err != nil {
+		return err
+	}
+	if c.turns, err = parseIntList("turns", *turnList); err != nil {
+		return err
+	}
+	if c.repeats = *repeats; c.repeats <= 0 {
+		return fmt.Errorf("repeats must be positive, not %d", c.repeats)
+	}
+	sort.Ints(c.threads)
+	for _, size := range c.sizes {
+		if err := checkPaths(golParams{imageWidth: size.width, imageHeight: size.height}); err != nil {
+			return err
+		}
+	}
+
+	// The images of each run are thrown away
+	dir, err := ioutil.TempDir("", "gol-scaling")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "{width}x{height}-{turns}")
+	results, err := runScalingStudy(c, output, timeGame, progress)
+	if err != nil {
+		return err
+	}
+
+	if err := writeScalingFile(*csvPath, results, writeScalingCSV); err != nil {
+		return err
+	}
+	return writeScalingFile(*svgPath, results, writeScalingSVG)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScalingLists(t *testing.T) {
+	threads, err := parseIntList("threads", "1, 2,4")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 4}, threads)
+	for _, bad := range []string{"", "1,,2", "0", "-1", "two"} {
+		_, err := parseIntList("threads", bad)
+		assert.Error(t, err, bad)
+	}
+
+	sizes, err := parseSizes("64x64, 1024x64")
+	require.NoError(t, err)
+	assert.Equal(t, []imageSize{{64, 64}, {1024, 64}}, sizes)
+	for _, bad := range []string{"", "64", "64x", "0x64", "64x64,x"} {
+		_, err := parseSizes(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// TestRunScalingStudy checks the study with a fake game whose time is the work split perfectly between threads,
+// plus a fixed cost, and an outlier on every third run.
+func TestRunScalingStudy(t *testing.T) {
+	runs := 0
+	play := func(p golParams) (time.Duration, error) {
+		runs++
+		assert.True(t, p.quiet, "the games should print nothing")
+		d := time.Duration(p.imageWidth*p.imageHeight*p.turns/p.threads)*time.Microsecond + time.Millisecond
+		if runs%3 == 0 {
+			d *= 10
+		}
+		return d, nil
+	}
+	c := scalingConfig{threads: []int{1, 2, 4, 32}, sizes: []imageSize{{16, 16}, {64, 64}}, turns: []int{10}, repeats: 3}
+	var progress bytes.Buffer
+	results, err := runScalingStudy(c, "", play, &progress)
+	require.NoError(t, err)
+	assert.Contains(t, progress.String(), "Skipping 32 threads on 16x16")
+	assert.Equal(t, 7*3, runs)
+	require.Len(t, results, 7)
+
+	// The median ignores the outlier
+	r := results[2]
+	assert.Equal(t, scalingResult{width: 16, height: 16, turns: 10, threads: 4}, scalingResult{width: r.width, height: r.height, turns: r.turns, threads: r.threads})
+	assert.InDelta(t, 0.001+0.00064, r.seconds, 1e-9)
+	assert.InDelta(t, (0.001+0.00256)/(0.001+0.00064), r.speedup, 1e-9)
+	assert.InDelta(t, r.speedup/4, r.efficiency, 1e-9)
+	assert.InDelta(t, 16*16*10/r.seconds, r.throughput(), 1e-6)
+
+	// Each series is relative to its own single thread run
+	assert.Equal(t, 1.0, results[0].speedup)
+	assert.Equal(t, 1.0, results[3].speedup)
+	assert.Equal(t, 1.0, results[3].efficiency)
+	assert.Equal(t, 32, results[6].threads)
+}
+
+func TestRunScalingStudyError(t *testing.T) {
+	c := scalingConfig{threads: []int{1}, sizes: []imageSize{{16, 16}}, turns: []int{1}, repeats: 1}
+	_, err := runScalingStudy(c, "", func(golParams) (time.Duration, error) { return 0, io.ErrUnexpectedEOF }, ioutil.Discard)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestAddSpeedupsWithoutOneThread(t *testing.T) {
+	series := []scalingResult{{threads: 2, seconds: 8}, {threads: 4, seconds: 5}, {threads: 8, seconds: 4}}
+	addSpeedups(series)
+	assert.Equal(t, []float64{1, 1.6, 2}, []float64{series[0].speedup, series[1].speedup, series[2].speedup})
+	assert.Equal(t, []float64{1, 0.8, 0.5}, []float64{series[0].efficiency, series[1].efficiency, series[2].efficiency})
+}
+
+// sampleScaling is a small study of two series.
+func sampleScaling() []scalingResult {
+	results := []scalingResult{
+		{width: 64, height: 64, turns: 100, threads: 1, seconds: 0.4},
+		{width: 64, height: 64, turns: 100, threads: 2, seconds: 0.25},
+		{width: 64, height: 64, turns: 100, threads: 4, seconds: 0.2},
+		{width: 128, height: 128, turns: 100, threads: 1, seconds: 1.6},
+		{width: 128, height: 128, turns: 100, threads: 2, seconds: 0.9},
+		{width: 128, height: 128, turns: 100, threads: 4, seconds: 0.5},
+	}
+	addSpeedups(results[:3])
+	addSpeedups(results[3:])
+	return results
+}
+
+func TestWriteScalingCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeScalingCSV(&buf, sampleScaling()))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 7)
+	assert.Equal(t, []string{"width", "height", "turns", "threads", "seconds", "cells_per_second", "speedup", "efficiency"}, records[0])
+	assert.Equal(t, []string{"64", "64", "100", "2", "0.25", "1.6384e+06", "1.600", "0.800"}, records[2])
+	assert.Equal(t, []string{"128", "128", "100", "4", "0.5", "3.2768e+06", "3.200", "0.800"}, records[6])
+}
+
+func TestNiceCeiling(t *testing.T) {
+	for v, want := range map[float64]float64{0: 1, 0.7: 1, 1: 1, 1.2: 2, 3.2: 5, 7: 10, 3276800: 5000000} {
+		assert.Equal(t, want, niceCeiling(v), "%g", v)
+	}
+	assert.Equal(t, "3.28M", formatSI(3276800))
+	assert.Equal(t, "0.25", formatSI(0.25))
+}
+
+func TestWriteScalingSVG(t *testing.T) {
+	var buf bytes.Buffer
+	require.Error(t, writeScalingSVG(&buf, nil))
+	require.NoError(t, writeScalingSVG(&buf, sampleScaling()))
+
+	// It must be well formed, with a line for each series in each panel and dashed ideal lines for two of them
+	elements := map[string]int{}
+	var texts []string
+	decoder := xml.NewDecoder(&buf)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		switch token := token.(type) {
+		case xml.StartElement:
+			elements[token.Name.Local]++
+		case xml.CharData:
+			if s := strings.TrimSpace(string(token)); s != "" {
+				texts = append(texts, s)
+			}
+		}
+	}
+	assert.Equal(t, 1, elements["svg"])
+	assert.Equal(t, 3*2+2*2, elements["polyline"])
+	assert.Equal(t, 3*6, elements["circle"])
+	assert.Subset(t, texts, []string{"Throughput (cells/s)", "Speedup", "Parallel efficiency", "64x64, 100 turns", "128x128, 100 turns"})
+}
+
+func TestRunScaling(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	csvPath, svgPath := filepath.Join(dir, "scaling.csv"), filepath.Join(dir, "chart", "scaling.svg")
+
+	stdoutBefore := os.Stdout
+	require.NoError(t, runScaling([]string{"-threads", "1,2", "-sizes", "16x16,64x64", "-turns", "5", "-repeats", "1",
+		"-csv", csvPath, "-svg", svgPath}, ioutil.Discard))
+	assert.Equal(t, stdoutBefore, os.Stdout)
+
+	data, err := ioutil.ReadFile(csvPath)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 5)
+	data, err = ioutil.ReadFile(svgPath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "<svg"))
+
+	for name, args := range map[string][]string{
+		"threads": {"-threads", "0"},
+		"sizes":   {"-sizes", "big"},
+		"turns":   {"-turns", "x"},
+		"repeats": {"-repeats", "0"},
+		"image":   {"-sizes", "20x20"},
+		"extra":   {"now"},
+	} {
+		assert.Error(t, runScaling(args, ioutil.Discard), name)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var soupSeed = flag.Int64("soup-seed", 1, "Seed for the random soups of TestRandomSoups.")
+var soupCases = flag.Int("soup-cases", 40, "Number of random soups TestRandomSoups plays.")
+
+// Bounds on the random soups, kept small so that many can be played and failures are easy to read.
+const (
+	maxSoupSize  = 40
+	maxSoupTurns = 30
+)
+
+// soupCase is a board, a way of splitting it between workers and a number of turns to play it for.
+type soupCase struct {
+	width, height int
+	threads       int
+	turns         int
+	alive         []cell
+}
+
+func (c soupCase) params() golParams {
+	return golParams{turns: c.turns, threads: c.threads, imageWidth: c.width, imageHeight: c.height, quiet: true}
+}
+
+// String describes the case with its starting board as an RLE pattern, which can be pasted into most Life programs.
+func (c soupCase) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%dx%d board, %d threads, %d turns, starting from:\n", c.width, c.height, c.threads, c.turns)
+	_ = encodeRle(&buf, c.width, c.height, testWorld(c.width, c.height, c.alive...))
+	return buf.String()
+}
+
+// randomSoup returns a board of random size and density, with a random number of threads and turns.
+func randomSoup(r *rand.Rand) soupCase {
+	c := soupCase{
+		width:  1 + r.Intn(maxSoupSize),
+		height: 1 + r.Intn(maxSoupSize),
+		turns:  r.Intn(maxSoupTurns + 1),
+	}
+	c.threads = 1 + r.Intn(c.height)
+	density := r.Float64()
+	for y := 0; y < c.height; y++ {
+		for x := 0; x < c.width; x++ {
+			if r.Float64() < density {
+				c.alive = append(c.alive, cell{x: x, y: y})
+			}
+		}
+	}
+	return c
+}
+
+// referenceStep plays a single turn on a torus in the most obvious way possible.
+func referenceStep(world [][]byte, width, height int) [][]byte {
+	next := testWorld(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			neighbours := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && world[(y+dy+height)%height][(x+dx+width)%width] != 0 {
+						neighbours++
+					}
+				}
+			}
+			if neighbours == 3 || neighbours == 2 && world[y][x] != 0 {
+				next[y][x] = 0xFF
+			}
+		}
+	}
+	return next
+}
+
+// sortCells puts cells in row order so that two sets of cells can be compared directly.
+func sortCells(cells []cell) []cell {
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].y != cells[j].y {
+			return cells[i].y < cells[j].y
+		}
+		return cells[i].x < cells[j].x
+	})
+	return cells
+}
+
+// referenceRun plays c with referenceStep.
+func referenceRun(c soupCase) []cell {
+	world := testWorld(c.width, c.height, c.alive...)
+	for turn := 0; turn < c.turns; turn++ {
+		world = referenceStep(world, c.width, c.height)
+	}
+	return sortCells(aliveCells(world))
+}
+
+// writeInput writes the starting board of c to dir and returns the params to play it from there.
+func (c soupCase) writeInput(dir string) (golParams, error) {
+	p := c.params()
+	p.input = filepath.Join(dir, "soup.pgm")
+	p.output = filepath.Join(dir, "result")
+
+	file, err := os.Create(p.input)
+	if err != nil {
+		return p, err
+	}
+	err = encodePgm(file, c.width, c.height, testWorld(c.width, c.height, c.alive...))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return p, err
+}
+
+// parallelRun plays c with gameOfLife, reading and writing files in dir.
+func parallelRun(c soupCase, dir string) ([]cell, error) {
+	p, err := c.writeInput(dir)
+	if err != nil {
+		return nil, err
+	}
+	alive, err := gameOfLife(p, nil)
+	return sortCells(alive), err
+}
+
+// crop returns c on the w x h part of its board whose top left corner is at (x, y), keeping only the cells in it
+// and no more threads than there are rows.
+func (c soupCase) crop(x, y, w, h int) soupCase {
+	smaller := c
+	smaller.width, smaller.height = w, h
+	if smaller.threads > h {
+		smaller.threads = h
+	}
+	smaller.alive = nil
+	for _, a := range c.alive {
+		if a.x >= x && a.x < x+w && a.y >= y && a.y < y+h {
+			smaller.alive = append(smaller.alive, cell{x: a.x - x, y: a.y - y})
+		}
+	}
+	return smaller
+}
+
+// cropped returns c with one column or row fewer, taken from each edge of the board in turn.
+func (c soupCase) cropped() []soupCase {
+	var smaller []soupCase
+	if c.width > 1 {
+		smaller = append(smaller, c.crop(0, 0, c.width-1, c.height), c.crop(1, 0, c.width-1, c.height))
+	}
+	if c.height > 1 {
+		smaller = append(smaller, c.crop(0, 0, c.width, c.height-1), c.crop(0, 1, c.width, c.height-1))
+	}
+	return smaller
+}
+
+// shrinkSoup looks for a smaller case that still fails, with fewer turns, fewer threads, a smaller board and fewer
+// alive cells, until no single change makes it smaller. The result is as small as this can find rather than the
+// smallest possible.
+func shrinkSoup(c soupCase, fails func(soupCase) bool) soupCase {
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for turns := 0; turns < c.turns; turns++ {
+			smaller := c
+			smaller.turns = turns
+			if fails(smaller) {
+				c = smaller
+				shrunk = true
+				break
+			}
+		}
+		for threads := 1; threads < c.threads; threads++ {
+			smaller := c
+			smaller.threads = threads
+			if fails(smaller) {
+				c = smaller
+				shrunk = true
+				break
+			}
+		}
+		for cropping := true; cropping; {
+			cropping = false
+			for _, smaller := range c.cropped() {
+				if fails(smaller) {
+					c = smaller
+					shrunk = true
+					cropping = true
+					break
+				}
+			}
+		}
+		for i := 0; i < len(c.alive); i++ {
+			smaller := c
+			smaller.alive = append(append([]cell(nil), c.alive[:i]...), c.alive[i+1:]...)
+			if fails(smaller) {
+				c = smaller
+				shrunk = true
+				i--
+			}
+		}
+	}
+	return c
+}
+
+// TestRandomSoups plays random soups with the workers and with referenceStep, and reports the smallest case
+// it can find where they disagree. Run with -soup-seed to try other soups.
+func TestRandomSoups(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	fails := func(c soupCase) bool {
+		alive, err := parallelRun(c, dir)
+		require.NoError(t, err, "%v", c)
+		return !assert.ObjectsAreEqual(referenceRun(c), alive)
+	}
+
+	r := rand.New(rand.NewSource(*soupSeed))
+	for i := 0; i < *soupCases; i++ {
+		c := randomSoup(r)
+		if fails(c) {
+			minimal := shrinkSoup(c, fails)
+			alive, _ := parallelRun(minimal, dir)
+			t.Fatalf("soup %d of seed %d fails. The smallest failing case found is a %s\nwant alive %v\ngot alive  %v",
+				i, *soupSeed, minimal, referenceRun(minimal), alive)
+		}
+	}
+}
+
+func TestReferenceStep(t *testing.T) {
+	// A glider crossing the corner of a torus comes back after 4*size turns
+	c := soupCase{width: 5, height: 5, turns: 20, alive: []cell{{4, 3}, {0, 4}, {3, 0}, {4, 0}, {0, 0}}}
+	assert.Equal(t, sortCells(c.alive), referenceRun(c))
+
+	// A blinker wrapped around the edge
+	c = soupCase{width: 6, height: 6, turns: 1, alive: []cell{{5, 2}, {0, 2}, {1, 2}}}
+	assert.Equal(t, []cell{{0, 1}, {0, 2}, {0, 3}}, referenceRun(c))
+}
+
+func TestShrinkSoup(t *testing.T) {
+	// A broken engine that never lets cells in the first column be born
+	broken := func(c soupCase) []cell {
+		world := testWorld(c.width, c.height, c.alive...)
+		for turn := 0; turn < c.turns; turn++ {
+			next := referenceStep(world, c.width, c.height)
+			for y := range next {
+				if world[y][0] == 0 {
+					next[y][0] = 0
+				}
+			}
+			world = next
+		}
+		return sortCells(aliveCells(world))
+	}
+	fails := func(c soupCase) bool {
+		return !assert.ObjectsAreEqual(referenceRun(c), broken(c))
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		c := randomSoup(r)
+		if !fails(c) {
+			continue
+		}
+		minimal := shrinkSoup(c, fails)
+		require.True(t, fails(minimal))
+		assert.True(t, minimal.turns <= c.turns && len(minimal.alive) <= len(c.alive))
+		assert.True(t, minimal.threads <= c.threads && minimal.width <= c.width && minimal.height <= c.height)
+
+		// Neither fewer turns, fewer threads, a row or column fewer nor any one cell fewer still fails
+		fewer := minimal
+		fewer.turns--
+		assert.False(t, fails(fewer), "%v", minimal)
+		if minimal.threads > 1 {
+			fewer = minimal
+			fewer.threads--
+			assert.False(t, fails(fewer), "%v", minimal)
+		}
+		for _, smaller := range minimal.cropped() {
+			assert.False(t, fails(smaller), "%v", minimal)
+		}
+		for i := range minimal.alive {
+			fewer := minimal
+			fewer.alive = append(append([]cell(nil), minimal.alive[:i]...), minimal.alive[i+1:]...)
+			assert.False(t, fails(fewer), "%v", minimal)
+		}
+	}
+}
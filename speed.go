@@ -0,0 +1,99 @@
+package main
+
+import "time"
+
+// speedLevels are the targets in turns per second that 'f' and 'd' step through.
+// A target of 0 means running as fast as possible.
+var speedLevels = []int{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// unthrottled is always ready to receive from, so turns run as fast as possible when it is used for turnTicks.
+var unthrottled = func() chan time.Time {
+	c := make(chan time.Time)
+	close(c)
+	return c
+}()
+
+// ticker is what the speed limit waits on between turns, which tests can tick by hand.
+type ticker interface {
+	ticks() <-chan time.Time
+	Stop()
+}
+
+// timeTicker is a ticker driven by the clock.
+type timeTicker struct {
+	*time.Ticker
+}
+
+func (t timeTicker) ticks() <-chan time.Time {
+	return t.C
+}
+
+func newTimeTicker(interval time.Duration) ticker {
+	return timeTicker{time.NewTicker(interval)}
+}
+
+// setSpeed changes the target number of turns per second, with 0 meaning as fast as possible.
+func (s *distributorState) setSpeed(turnsPerSecond int) {
+	if turnsPerSecond < 0 {
+		turnsPerSecond = 0
+	}
+	s.speed = turnsPerSecond
+	if s.throttle != nil {
+		s.throttle.Stop()
+		s.throttle = nil
+	}
+	if turnsPerSecond > 0 {
+		newTicker := s.d.newTicker
+		if newTicker == nil {
+			newTicker = newTimeTicker
+		}
+		s.throttle = newTicker(time.Second / time.Duration(turnsPerSecond))
+	}
+}
+
+// faster moves to the next speed level, or removes the limit when past the last one.
+func (s *distributorState) faster() {
+	if s.speed == 0 {
+		return
+	}
+	for _, level := range speedLevels {
+		if level > s.speed {
+			s.setSpeed(level)
+			return
+		}
+	}
+	s.setSpeed(0)
+}
+
+// slower moves to the previous speed level, starting from the last one when there is no limit.
+func (s *distributorState) slower() {
+	if s.speed == 0 {
+		s.setSpeed(speedLevels[len(speedLevels)-1])
+		return
+	}
+	for i := len(speedLevels) - 1; i >= 0; i-- {
+		if speedLevels[i] < s.speed {
+			s.setSpeed(speedLevels[i])
+			return
+		}
+	}
+}
+
+// turnTicks returns the chan the turn loop waits on before computing the next turn.
+func (s *distributorState) turnTicks() <-chan time.Time {
+	if s.throttle == nil {
+		return unthrottled
+	}
+	return s.throttle.ticks()
+}
+
+// runUntilTurn resumes the game and pauses it again once turn has been completed.
+func (s *distributorState) runUntilTurn(turn int) {
+	if turn <= s.turn {
+		s.runUntil = 0
+		s.setState(PAUSE)
+		return
+	}
+	s.runUntil = turn
+	s.setState(CONTINUE)
+}
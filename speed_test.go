@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gameStatus(control chan<- controlRequest) controlResponse {
+	reply := make(chan controlResponse, 1)
+	control <- controlRequest{command: controlStatus, reply: reply}
+	return <-reply
+}
+
+// waitForPause polls the game until it is paused.
+func waitForPause(t *testing.T, control chan<- controlRequest) controlResponse {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if res := gameStatus(control); res.state == PAUSE {
+			return res
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.FailNow(t, "game never paused")
+	return controlResponse{}
+}
+
+func TestSingleStep(t *testing.T) {
+	key, control, finalAlive := startEditTest(t)
+
+	sendKeys(key, "p")
+	turn := gameStatus(control).turn
+	sendKeys(key, "n")
+	assert.Equal(t, turn+1, gameStatus(control).turn)
+	sendKeys(key, "10n")
+	assert.Equal(t, turn+11, gameStatus(control).turn)
+
+	// Escape cancels a count, so this steps once
+	sendKeys(key, "5")
+	key <- keyEsc
+	sendKeys(key, "n")
+	res := gameStatus(control)
+	assert.Equal(t, turn+12, res.turn)
+	assert.Equal(t, PAUSE, res.state)
+
+	sendKeys(key, "q")
+	<-finalAlive
+}
+
+func TestRunUntil(t *testing.T) {
+	key, control, finalAlive := startEditTest(t)
+
+	sendKeys(key, "p")
+	target := gameStatus(control).turn + 300
+	sendKeys(key, strconv.Itoa(target)+"u")
+	res := waitForPause(t, control)
+	assert.Equal(t, target, res.turn)
+	assert.Equal(t, 0, res.runUntil)
+
+	// Asking to run to a turn that has already passed just stays paused
+	sendKeys(key, "1u")
+	res = gameStatus(control)
+	assert.Equal(t, target, res.turn)
+	assert.Equal(t, PAUSE, res.state)
+
+	sendKeys(key, "q")
+	<-finalAlive
+}
+
+// manualTicker is a ticker that only ticks when the test sends on it.
+type manualTicker chan time.Time
+
+func (m manualTicker) ticks() <-chan time.Time {
+	return m
+}
+
+func (m manualTicker) Stop() {}
+
+func TestSpeedControl(t *testing.T) {
+	intervals := make(chan time.Duration, 10)
+	tick := make(manualTicker)
+	key, control, finalAlive := startKeyTest(t, golParams{turns: 1000000000, threads: 4, imageWidth: 16, imageHeight: 16}, externalChans{newTicker: func(interval time.Duration) ticker {
+		intervals <- interval
+		return tick
+	}})
+
+	sendKeys(key, "20f")
+	assert.Equal(t, 20, gameStatus(control).speed)
+	assert.Equal(t, 50*time.Millisecond, <-intervals)
+
+	// Turns only run when the ticker ticks, one for each tick
+	before := gameStatus(control).turn
+	assert.Equal(t, before, gameStatus(control).turn)
+	for i := 0; i < 5; i++ {
+		tick <- time.Time{}
+	}
+	assert.Equal(t, before+5, gameStatus(control).turn)
+
+	sendKeys(key, "f")
+	assert.Equal(t, 50, gameStatus(control).speed)
+	assert.Equal(t, 20*time.Millisecond, <-intervals)
+	sendKeys(key, "dd")
+	assert.Equal(t, 10, gameStatus(control).speed)
+	assert.Equal(t, 50*time.Millisecond, <-intervals)
+	assert.Equal(t, 100*time.Millisecond, <-intervals)
+	sendKeys(key, "0f")
+	assert.Equal(t, 0, gameStatus(control).speed)
+	sendKeys(key, "d")
+	assert.Equal(t, 1000, gameStatus(control).speed)
+	assert.Equal(t, time.Millisecond, <-intervals)
+	sendKeys(key, "f")
+	assert.Equal(t, 0, gameStatus(control).speed)
+	assert.Empty(t, intervals)
+
+	sendKeys(key, "q")
+	<-finalAlive
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// videoFrameRate is the frame rate written in y4m headers.
+const videoFrameRate = 30
+
+// videoBufferSize is the number of frames waiting to be written before new frames are dropped.
+const videoBufferSize = 64
+
+// videoStream writes frames to a y4m or raw greyscale stream in its own goroutine,
+// so that a slow consumer only ever costs dropped frames rather than holding up the workers.
+type videoStream struct {
+	p       golParams
+	frames  chan [][]byte
+	done    chan error
+	dropped int
+}
+
+// openVideo starts writing frames to p.videoOut, which may be "-" for stdout.
+func openVideo(p golParams) (*videoStream, error) {
+	if p.videoFormat != "" && p.videoFormat != "y4m" && p.videoFormat != "raw" {
+		return nil, fmt.Errorf("video format must be y4m or raw, not %q", p.videoFormat)
+	}
+	w, err := createOutput(p.videoOut)
+	if err != nil {
+		return nil, err
+	}
+	return startVideo(p, w), nil
+}
+
+// startVideo starts writing frames to w, which is closed once the stream is.
+func startVideo(p golParams, w io.WriteCloser) *videoStream {
+	v := &videoStream{p: p, frames: make(chan [][]byte, videoBufferSize), done: make(chan error, 1)}
+	go v.write(w)
+	return v
+}
+
+// send queues a copy of world to be written, dropping it if the writer has fallen too far behind.
+func (v *videoStream) send(world [][]byte) {
+	frame := make([][]byte, len(world))
+	for y := range world {
+		frame[y] = append([]byte(nil), world[y]...)
+	}
+	select {
+	case v.frames <- frame:
+	default:
+		v.dropped++
+	}
+}
+
+// close waits for the queued frames to be written and closes the stream.
+func (v *videoStream) close() error {
+	close(v.frames)
+	err := <-v.done
+	if v.dropped > 0 {
+		fmt.Fprintln(v.p.messages(), "Warning:", v.dropped, "video frames were dropped because the output was too slow")
+	}
+	return err
+}
+
+// write encodes every frame it receives to w until frames is closed.
+// After an error the remaining frames are thrown away, so that send never blocks.
+func (v *videoStream) write(w io.WriteCloser) {
+	buf := bufio.NewWriter(w)
+	style := styleFor(v.p)
+	err := encodeVideoHeader(buf, v.p, style)
+	for world := range v.frames {
+		if err == nil {
+			err = encodeVideoFrame(buf, v.p, style, world)
+		}
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	v.done <- err
+}
+
+// encodeVideoHeader writes the y4m stream header. Raw streams have no header.
+func encodeVideoHeader(w io.Writer, p golParams, style imageStyle) error {
+	if p.videoFormat == "raw" {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 Cmono\n",
+		p.imageWidth*style.scale, p.imageHeight*style.scale, videoFrameRate)
+	return err
+}
+
+// encodeVideoFrame writes world as a single greyscale frame, with white alive cells drawn scale pixels wide.
+func encodeVideoFrame(w io.Writer, p golParams, style imageStyle, world [][]byte) error {
+	if p.videoFormat != "raw" {
+		if _, err := io.WriteString(w, "FRAME\n"); err != nil {
+			return err
+		}
+	}
+	row := make([]byte, p.imageWidth*style.scale)
+	for y := 0; y < p.imageHeight; y++ {
+		for x := 0; x < p.imageWidth; x++ {
+			var luma byte
+			if world[y][x] != 0 {
+				luma = 0xFF
+			}
+			for i := 0; i < style.scale; i++ {
+				row[x*style.scale+i] = luma
+			}
+		}
+		for i := 0; i < style.scale; i++ {
+			if _, err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
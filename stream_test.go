@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeVideo(t *testing.T) {
+	p := golParams{imageWidth: 3, imageHeight: 2}
+	world := testWorld(3, 2, cell{1, 0}, cell{2, 1})
+	style := imageStyle{scale: 2, palette: palettes["mono"]}
+
+	var buf bytes.Buffer
+	require.NoError(t, encodeVideoHeader(&buf, p, style))
+	require.NoError(t, encodeVideoFrame(&buf, p, style, world))
+	assert.Equal(t, "YUV4MPEG2 W6 H4 F30:1 Ip A1:1 Cmono\nFRAME\n"+
+		"\x00\x00\xff\xff\x00\x00"+
+		"\x00\x00\xff\xff\x00\x00"+
+		"\x00\x00\x00\x00\xff\xff"+
+		"\x00\x00\x00\x00\xff\xff", buf.String())
+
+	p.videoFormat = "raw"
+	buf.Reset()
+	require.NoError(t, encodeVideoHeader(&buf, p, styleFor(p)))
+	require.NoError(t, encodeVideoFrame(&buf, p, styleFor(p), world))
+	assert.Equal(t, "\x00\xff\x00\x00\x00\xff", buf.String())
+}
+
+// blockedWriter never returns from Write until it is released.
+type blockedWriter struct {
+	release chan struct{}
+}
+
+func (w blockedWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return len(b), nil
+}
+
+func TestVideoDropsFrames(t *testing.T) {
+	w := blockedWriter{make(chan struct{})}
+
+	// Each frame fills the writer's buffer, so it blocks on the first or second one
+	v := startVideo(golParams{imageWidth: 64, imageHeight: 64, videoFormat: "raw"}, nopWriteCloser{w})
+	// None of these can block, even though nothing is being written
+	for i := 0; i < 10*videoBufferSize; i++ {
+		v.send(testWorld(64, 64))
+	}
+	assert.True(t, v.dropped >= 9*videoBufferSize-2, "only %d frames dropped", v.dropped)
+	close(w.release)
+	assert.NoError(t, v.close())
+}
+
+func TestVideoFormatError(t *testing.T) {
+	_, err := openVideo(golParams{videoOut: "-", videoFormat: "mp4"})
+	assert.Error(t, err)
+}
+
+// TestVideoOutput runs a game with a video stream and checks there is a frame for every few turns.
+func TestVideoOutput(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "run.y4m")
+
+	p := golParams{turns: 10, threads: 4, imageWidth: 16, imageHeight: 16, videoOut: path, videoEvery: 5, scale: 2,
+		output: filepath.Join(dir, "board")}
+	alive, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	header := []byte("YUV4MPEG2 W32 H32 F30:1 Ip A1:1 Cmono\n")
+	require.True(t, bytes.HasPrefix(data, header))
+	frames := bytes.Split(data[len(header):], []byte("FRAME\n"))[1:]
+
+	// Turns 0, 5 and 10
+	require.Len(t, frames, 3)
+	var last []cell
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if frames[2][(2*y)*32+2*x] == 0xFF {
+				last = append(last, cell{x: x, y: y})
+			}
+		}
+	}
+	assert.ElementsMatch(t, alive, last)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// maxTraceTurns is the most turns of each worker kept for the trace file, so that a long run can't use up all the memory.
+// The summary covers every turn.
+const maxTraceTurns = 10000
+
+// turnSpan is when a worker was given a turn and when it finished each part of it.
+type turnSpan struct {
+	waiting   time.Time // Finished the turn before, or started
+	started   time.Time // Given the turn
+	exchanged time.Time // Finished swapping halo rows with its neighbours
+	done      time.Time // Finished computing
+}
+
+// workerTrace records the turns of a single worker. It is only touched by that worker while the game runs.
+// A nil *workerTrace records nothing.
+type workerTrace struct {
+	spans                  []turnSpan
+	turns                  int
+	compute, halo, waiting time.Duration
+}
+
+func (w *workerTrace) record(s turnSpan) {
+	if w == nil {
+		return
+	}
+	if len(w.spans) < maxTraceTurns {
+		w.spans = append(w.spans, s)
+	}
+	w.turns++
+	w.waiting += s.started.Sub(s.waiting)
+	w.halo += s.exchanged.Sub(s.started)
+	w.compute += s.done.Sub(s.exchanged)
+}
+
+// tracer records how every worker spends each turn, for -trace-out.
+// A nil *tracer records nothing.
+type tracer struct {
+	start   time.Time
+	workers []workerTrace
+}
+
+func newTracer(threads int) *tracer {
+	return &tracer{start: time.Now(), workers: make([]workerTrace, threads)}
+}
+
+// worker returns the trace of the ith worker, or nil if tracing is disabled.
+func (t *tracer) worker(i int) *workerTrace {
+	if t == nil {
+		return nil
+	}
+	return &t.workers[i]
+}
+
+// traceEvent is an event in the Chrome trace event format, which chrome://tracing and Perfetto can show.
+// Times are in microseconds.
+type traceEvent struct {
+	Name  string                 `json:"name"`
+	Phase string                 `json:"ph"`
+	Time  float64                `json:"ts"`
+	Dur   float64                `json:"dur"`
+	PID   int                    `json:"pid"`
+	TID   int                    `json:"tid"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// micros returns how many microseconds after the start of the trace t was.
+func (t *tracer) micros(at time.Time) float64 {
+	return float64(at.Sub(t.start)) / float64(time.Microsecond)
+}
+
+// events returns a track of spans for each worker, and a track of whole turns from when the first worker was given
+// the turn to when the last one finished it.
+func (t *tracer) events() []traceEvent {
+	turnsTrack := len(t.workers)
+	events := []traceEvent{{Name: "thread_name", Phase: "M", TID: turnsTrack, Args: map[string]interface{}{"name": "turns"}}}
+	for i := range t.workers {
+		events = append(events, traceEvent{Name: "thread_name", Phase: "M", TID: i,
+			Args: map[string]interface{}{"name": fmt.Sprintf("worker %d", i)}})
+	}
+
+	span := func(name string, tid, turn int, from, to time.Time) traceEvent {
+		return traceEvent{Name: name, Phase: "X", Time: t.micros(from), Dur: t.micros(to) - t.micros(from), TID: tid,
+			Args: map[string]interface{}{"turn": turn}}
+	}
+	for i, w := range t.workers {
+		for turn, s := range w.spans {
+			events = append(events,
+				span("wait", i, turn+1, s.waiting, s.started),
+				span("halo", i, turn+1, s.started, s.exchanged),
+				span("compute", i, turn+1, s.exchanged, s.done))
+		}
+	}
+	for turn := 0; ; turn++ {
+		var first, last time.Time
+		for _, w := range t.workers {
+			if turn >= len(w.spans) {
+				return events
+			}
+			if s := w.spans[turn]; first.IsZero() || s.started.Before(first) {
+				first = s.started
+			}
+			if s := w.spans[turn]; s.done.After(last) {
+				last = s.done
+			}
+		}
+		events = append(events, span(fmt.Sprintf("turn %d", turn+1), turnsTrack, turn+1, first, last))
+	}
+}
+
+// writeTrace writes the trace as Chrome trace event JSON.
+func (t *tracer) writeTrace(w io.Writer) error {
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{t.events(), "ms"})
+}
+
+// traceSummary is where the time of each worker went and how evenly the work was shared.
+type traceSummary struct {
+	turns     int
+	workers   []workerTrace
+	slowest   int     // Worker that spent the longest computing
+	imbalance float64 // How much longer the slowest worker computed for than the mean, as a fraction of the mean
+	slowestIn []int   // Number of recorded turns each worker finished computing last
+}
+
+func (t *tracer) summary() traceSummary {
+	s := traceSummary{workers: t.workers, slowestIn: make([]int, len(t.workers))}
+	var total time.Duration
+	for i, w := range t.workers {
+		if w.compute > t.workers[s.slowest].compute {
+			s.slowest = i
+		}
+		if w.turns > s.turns {
+			s.turns = w.turns
+		}
+		total += w.compute
+	}
+	if mean := float64(total) / float64(len(t.workers)); mean > 0 {
+		s.imbalance = float64(t.workers[s.slowest].compute)/mean - 1
+	}
+	for turn := 0; ; turn++ {
+		last := -1
+		for i, w := range t.workers {
+			if turn >= len(w.spans) {
+				return s
+			}
+			if last < 0 || w.spans[turn].done.After(t.workers[last].spans[turn].done) {
+				last = i
+			}
+		}
+		s.slowestIn[last]++
+	}
+}
+
+// noinspection GoUnhandledErrorResult
+func (s traceSummary) write(out io.Writer) error {
+	fmt.Fprintf(out, "Trace of %d turns on %d workers:\n", s.turns, len(s.workers))
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "Worker\tCompute\tHalo\tWait\tTurns finished last")
+	for i, worker := range s.workers {
+		fmt.Fprintf(w, "%d\t%v\t%v\t%v\t%d\n", i, worker.compute.Round(time.Microsecond),
+			worker.halo.Round(time.Microsecond), worker.waiting.Round(time.Microsecond), s.slowestIn[i])
+	}
+	w.Flush()
+	fmt.Fprintf(out, "Slowest worker: %d, computing for %v\n", s.slowest, s.workers[s.slowest].compute.Round(time.Microsecond))
+	_, err := fmt.Fprintf(out, "Load imbalance: %.1f%% (the slowest worker's compute time over the mean)\n", s.imbalance*100)
+	return err
+}
+
+// writeTraceFile writes the trace to path and the summary to messages.
+func (t *tracer) writeTraceFile(path string, messages io.Writer) error {
+	file, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	err = t.writeTrace(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(messages, "File", path, "trace done!")
+	_ = t.summary().write(messages)
+	return nil
+}
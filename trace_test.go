@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTracer makes a trace where each worker waits, swaps halos and computes for the given number of milliseconds
+// in every turn, one turn straight after another. Compute times are taken from the worker's list in turn.
+func fakeTracer(turns int, wait, halo []time.Duration, compute [][]time.Duration) *tracer {
+	t := newTracer(len(compute))
+	for i := range compute {
+		at := t.start
+		for turn := 0; turn < turns; turn++ {
+			s := turnSpan{waiting: at}
+			s.started = s.waiting.Add(wait[i] * time.Millisecond)
+			s.exchanged = s.started.Add(halo[i] * time.Millisecond)
+			s.done = s.exchanged.Add(compute[i][turn%len(compute[i])] * time.Millisecond)
+			t.worker(i).record(s)
+			at = s.done
+		}
+	}
+	return t
+}
+
+func TestWorkerTraceRecord(t *testing.T) {
+	var disabled *tracer
+	disabled.worker(3).record(turnSpan{}) // Records nothing
+
+	tr := fakeTracer(maxTraceTurns+5, []time.Duration{1}, []time.Duration{2}, [][]time.Duration{{3}})
+	w := tr.workers[0]
+	assert.Len(t, w.spans, maxTraceTurns)
+	assert.Equal(t, maxTraceTurns+5, w.turns)
+	assert.Equal(t, time.Duration(maxTraceTurns+5)*time.Millisecond, w.waiting)
+	assert.Equal(t, time.Duration(maxTraceTurns+5)*2*time.Millisecond, w.halo)
+	assert.Equal(t, time.Duration(maxTraceTurns+5)*3*time.Millisecond, w.compute)
+}
+
+func TestTraceSummary(t *testing.T) {
+	// Worker 1 is slowest overall, but worker 0 finishes last in the first turn
+	tr := fakeTracer(4, []time.Duration{0, 0, 0}, []time.Duration{1, 1, 1}, [][]time.Duration{{10, 1}, {8, 8}, {3, 3}})
+	s := tr.summary()
+	assert.Equal(t, 4, s.turns)
+	assert.Equal(t, 1, s.slowest)
+	// Worker 1 computed for 32ms against a mean of 22ms
+	assert.InDelta(t, 32.0/22-1, s.imbalance, 1e-9)
+	assert.Equal(t, []int{1, 3, 0}, s.slowestIn)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.write(&buf))
+	assert.Equal(t, "Trace of 4 turns on 3 workers:\n"+
+		"Worker   Compute   Halo   Wait   Turns finished last\n"+
+		"0        22ms      4ms    0s     1\n"+
+		"1        32ms      4ms    0s     3\n"+
+		"2        12ms      4ms    0s     0\n"+
+		"Slowest worker: 1, computing for 32ms\n"+
+		"Load imbalance: 45.5% (the slowest worker's compute time over the mean)\n", buf.String())
+}
+
+// decodeTrace reads Chrome trace event JSON.
+func decodeTrace(t *testing.T, data []byte) []traceEvent {
+	var trace struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}
+	require.NoError(t, json.Unmarshal(data, &trace))
+	assert.Equal(t, "ms", trace.DisplayTimeUnit)
+	return trace.TraceEvents
+}
+
+func TestTraceEvents(t *testing.T) {
+	tr := fakeTracer(3, []time.Duration{1, 2}, []time.Duration{1, 1}, [][]time.Duration{{5}, {2}})
+	var buf bytes.Buffer
+	require.NoError(t, tr.writeTrace(&buf))
+	events := decodeTrace(t, buf.Bytes())
+
+	names := map[string]int{}
+	for _, e := range events {
+		names[e.Name]++
+	}
+	assert.Equal(t, map[string]int{"thread_name": 3, "wait": 6, "halo": 6, "compute": 6, "turn 1": 1, "turn 2": 1, "turn 3": 1}, names)
+
+	// Worker 0's second turn computes from 7ms to 12ms
+	var compute []traceEvent
+	for _, e := range events {
+		if e.Name == "compute" && e.TID == 0 {
+			compute = append(compute, e)
+		}
+	}
+	require.Len(t, compute, 3)
+	assert.Equal(t, "X", compute[1].Phase)
+	assert.Equal(t, 9000.0, compute[1].Time)
+	assert.Equal(t, 5000.0, compute[1].Dur)
+	assert.Equal(t, 2.0, compute[1].Args["turn"])
+
+	// The first turn runs from worker 0 being given it at 1ms to worker 0 finishing at 7ms
+	for _, e := range events {
+		if e.Name == "turn 1" {
+			assert.Equal(t, 2, e.TID)
+			assert.Equal(t, 1000.0, e.Time)
+			assert.Equal(t, 6000.0, e.Dur)
+		}
+	}
+}
+
+func TestTraceOut(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	p := golParams{turns: 20, threads: 4, imageWidth: 16, imageHeight: 16, output: filepath.Join(dir, "board"),
+		traceOut: filepath.Join(dir, "{turns}-trace.json")}
+	_, err := gameOfLife(p, nil)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "20-trace.json"))
+	require.NoError(t, err)
+	turns, spans := 0, map[int]int{}
+	for _, e := range decodeTrace(t, data) {
+		switch {
+		case strings.HasPrefix(e.Name, "turn "):
+			turns++
+		case e.Phase == "X":
+			spans[e.TID]++
+			assert.True(t, e.Dur >= 0, "%+v", e)
+		}
+	}
+	assert.Equal(t, 20, turns)
+	assert.Equal(t, map[int]int{0: 60, 1: 60, 2: 60, 3: 60}, spans)
+
+	p.traceOut = filepath.Join(dir, "{nope}.json")
+	assert.Error(t, validateParams(p))
+	p.traceOut = blockedOutput(t, dir)
+	_, err = gameOfLife(p, nil)
+	assert.Error(t, err)
+}